@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "last_successful_scrape_timestamp_seconds"),
+		"Timestamp of the last collection of the target in which all collectors succeeded.",
+		[]string{"host"},
+		nil,
+	)
+
+	// results holds the last collection result of every target, keyed by
+	// host and guarded by lock.
+	results = make(map[string]targetResult)
+)
+
+type targetResult struct {
+	metrics     []prometheus.Metric
+	collected   time.Time
+	lastSuccess time.Time
+}
+
+// storeResult replaces the cached result of a target. Results of targets
+// removed by a reload while they were being collected are discarded.
+func storeResult(host string, collected []prometheus.Metric, ok bool) {
+	now := time.Now()
+	lock.Lock()
+	defer lock.Unlock()
+	if _, configured := findTarget(config, host); !configured {
+		return
+	}
+	result := results[host]
+	result.metrics = collected
+	result.collected = now
+	if ok {
+		result.lastSuccess = now
+	}
+	results[host] = result
+}
+
+// collectResults sends the cached metrics of all targets. Results older than
+// Global.Staleness seconds are left out, though the last success timestamp
+// of their target is still reported.
+func collectResults(ch chan<- prometheus.Metric) {
+	lock.RLock()
+	defer lock.RUnlock()
+	staleness := time.Second * time.Duration(config.Global.Staleness)
+	for host, result := range results {
+		if !result.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				lastSuccessDesc,
+				prometheus.GaugeValue,
+				float64(result.lastSuccess.Unix()),
+				host,
+			)
+		}
+		if staleness > 0 && time.Since(result.collected) > staleness {
+			continue
+		}
+		for _, metric := range result.metrics {
+			if metric != nil {
+				ch <- metric
+			}
+		}
+	}
+}
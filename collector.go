@@ -1,16 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"encoding/csv"
+	"context"
 	"errors"
 	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/prometheus/client_golang/prometheus"
 	"io/ioutil"
 	"math"
-	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,112 +15,187 @@ import (
 
 const (
 	namespace   = "ipmi"
-)
 
-var (
-	ipmiDCMICurrentPowerRegex = regexp.MustCompile(`^Current Power\s*:\s*(?P<value>[0-9.]*)\s*Watts.*`)
-	ipmiChassisPowerRegex     = regexp.MustCompile(`^System Power\s*:\s(?P<value>.*)`)
-	ipmiChassisDriveRegex     = regexp.MustCompile(`^Drive Fault\s*:\s(?P<value>.*)`)
-	ipmiChassisCollingRegex   = regexp.MustCompile(`^Cooling/fan fault\s*:\s(?P<value>.*)`)
+	chassisPowerKey   = "System Power"
+	chassisDriveKey   = "Drive Fault"
+	chassisCoolingKey = "Cooling/fan fault"
 )
 
 type collector struct{}
 
+// targetCollector scrapes a single target on every collection.
+type targetCollector struct {
+	ctx    context.Context
+	target ipmiTarget
+	// store caches the result and schedules the next collection of the
+	// target, as a collection by the scheduler would.
+	store bool
+}
+
 type sensorData struct {
-	ID    int64
-	Name  string
-	Type  string
-	State string
-	Value float64
-	Unit  string
-	Event string
+	ID   int64
+	Name string
+	// RawName is the name as printed by the BMC, Name the normalized one.
+	RawName string
+	Type    string
+	State   string
+	Value   float64
+	Unit    string
+	// Events holds the event strings reported with the reading.
+	Events []string
 }
 
 var (
 	sensorStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "sensor", "state"),
 		"Indicates the severity of the state reported by an IPMI sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "type", "host"},
+		[]string{"id", "name", "raw_name", "type", "host"},
 		nil,
 	)
 
 	sensorValueDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "sensor", "value"),
 		"Generic data read from an IPMI sensor of unknown type, relying on labels for context.",
-		[]string{"id", "name", "type", "host"},
+		[]string{"id", "name", "raw_name", "type", "host"},
+		nil,
+	)
+
+	sensorEventDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sensor", "event_asserted"),
+		"Always 1 for every event an IPMI sensor currently asserts.",
+		[]string{"id", "name", "raw_name", "type", "event", "host"},
 		nil,
 	)
 
 	fanSpeedDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "fan_speed", "rpm"),
 		"Fan speed in rotations per minute.",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	fanSpeedStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "fan_speed", "state"),
 		"Reported state of a fan speed sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	temperatureDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "temperature", "celsius"),
 		"Temperature reading in degree Celsius.",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	temperatureStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "temperature", "state"),
 		"Reported state of a temperature sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	voltageDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "voltage", "volts"),
 		"Voltage reading in Volts.",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	voltageStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "voltage", "state"),
 		"Reported state of a voltage sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	currentDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "current", "amperes"),
 		"Current reading in Amperes.",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	currentStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "current", "state"),
 		"Reported state of a current sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	powerDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "power", "watts"),
 		"Power reading in Watts.",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
 	powerStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "power", "state"),
 		"Reported state of a power sensor (0=nominal, 1=warning, 2=critical).",
-		[]string{"id", "name", "host"},
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	fanDutyCycleDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fan_duty_cycle", "percent"),
+		"Fan duty cycle in percent of full speed.",
+		[]string{"id", "name", "raw_name", "host"},
 		nil,
 	)
 
+	fanDutyCycleStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fan_duty_cycle", "state"),
+		"Reported state of a fan duty cycle sensor (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	fanStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fan", "state"),
+		"Reported state of a discrete fan sensor like presence or redundancy (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	driveSlotStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "drive_slot", "state"),
+		"Reported state of a drive slot sensor (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	powerSupplyStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "power_supply", "state"),
+		"Reported state of a discrete power supply sensor (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	memoryStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "memory", "state"),
+		"Reported state of a memory sensor (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	batteryStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "battery", "state"),
+		"Reported state of a battery sensor (0=nominal, 1=warning, 2=critical).",
+		[]string{"id", "name", "raw_name", "host"},
+		nil,
+	)
+
+	// discreteStateDescs map the types of sensors without a reading to
+	// their state metric.
+	discreteStateDescs = map[string]*prometheus.Desc{
+		"Fan":          fanStateDesc,
+		"Drive Slot":   driveSlotStateDesc,
+		"Power Supply": powerSupplyStateDesc,
+		"Memory":       memoryStateDesc,
+		"Battery":      batteryStateDesc,
+	}
+
 	powerConsumption = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "dcmi", "power_consumption_watts"),
 		"Current power consumption in Watts.",
@@ -165,110 +237,280 @@ var (
 		[]string{"host"},
 		nil,
 	)
+
+	collectorTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "collector_timeouts_total",
+			Help:      "Number of times a collector was aborted because the target or command timed out.",
+		},
+		[]string{"collector", "host"},
+	)
+
+	sensorParseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "sensor",
+			Name:      "parse_errors_total",
+			Help:      "Number of ipmimonitoring and ipmi-sensors lines skipped because they could not be parsed.",
+		},
+		[]string{"host"},
+	)
 )
 
-func ipmiOutput(name string, args []string) ([]byte, error) {
-	cmd := exec.Command(name, args...)
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		log.Error(fmt.Sprint(err) + ":" + stderr.String())
-		return nil, errors.New(stderr.String())
+// commandContext bounds a single FreeIPMI command or native exchange with
+// target by Global.CommandTimeOut, within the deadline of the whole target.
+func commandContext(ctx context.Context, target ipmiTarget) (context.Context, context.CancelFunc) {
+	if timeout := target.settings().Global.CommandTimeOut; timeout > 0 {
+		return context.WithTimeout(ctx, time.Second*time.Duration(timeout))
 	}
-	return out.Bytes(), err
+	return context.WithCancel(ctx)
 }
 
-func splitMonitoringOutput(impiOutput []byte) ([]sensorData, error) {
-	var result []sensorData
+// freeipmiArgs returns the connection arguments shared by all FreeIPMI tools,
+// followed by any tool specific arguments.
+func freeipmiArgs(target ipmiTarget, extra ...string) []string {
+	module := target.module()
+	args := []string{
+		"-D", module.Drive,
+		"-h", target.Host,
+		"-u", target.User,
+	}
+	if module.Privilege != "" {
+		args = append(args, "-l", module.Privilege)
+	}
+	if module.CipherSuite != nil {
+		args = append(args, "-I", strconv.Itoa(*module.CipherSuite))
+	}
+	args = append(args, module.Args...)
+	return append(args, extra...)
+}
 
-	r := csv.NewReader(bytes.NewReader(impiOutput))
-	records, err := r.ReadAll()
-	for _, line := range records {
-		//line = strings.Fields(line[0])
-		line = strings.Split(line[0], "|")
-		for i := 0; i < len(line); i++ {
-			line[i] = strings.Trim(line[i], " ")
-		}
-		var data sensorData
-		data.ID, err = strconv.ParseInt(line[0], 10, 64)
-		if err != nil {
+// monitoringFields is the number of columns printed by ipmimonitoring: ID,
+// name, type, state, reading, units and event.
+const monitoringFields = 7
+
+// monitoringArgs make ipmimonitoring print one comma separated line per
+// sensor. Event strings are kept rather than requesting the event bitmask,
+// as they are exported as labels.
+var monitoringArgs = []string{"--comma-separated-output", "--no-header-output"}
+
+// splitSensorTable splits the output of ipmimonitoring or ipmi-sensors into
+// rows of at most columns trimmed fields. Both the comma separated and the
+// default table format are understood, per line, and the header row is
+// dropped.
+func splitSensorTable(ipmiOutput []byte, columns int) [][]string {
+	text := strings.TrimPrefix(string(ipmiOutput), "\ufeff")
+	var lines, seps []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
-		if len(strings.Fields(line[1])) > 1 {
-			data.Name = strings.ReplaceAll(line[1], " ", "_")
-			data.Name = strings.ReplaceAll(data.Name, "/", "")
-		} else {
-			data.Name = line[1]
+		sep := lineSeparator(line)
+		// An event string containing a line break continues on the next
+		// line, which lacks the other columns.
+		if n := len(lines); n > 0 && strings.Count(line, sep) < columns-1 && openQuote(lines[n-1]) {
+			lines[n-1] += " " + strings.TrimSpace(line)
+			continue
 		}
-		if strings.Index(data.Name, "-") == 2 {
-			data.Name = data.Name[3:]
-			data.Name = strings.ReplaceAll(data.Name, "-", "_")
+		lines = append(lines, line)
+		seps = append(seps, sep)
+	}
+	var rows [][]string
+	for n, line := range lines {
+		fields := strings.SplitN(line, seps[n], columns)
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
 		}
-		data.Type = line[2]
-		data.State = line[3]
-		value := line[4]
-		if value != "N/A" {
-			data.Value, err = strconv.ParseFloat(value, 64)
-			if err != nil {
-				return result, err
-			}
-		} else {
-			data.Value = math.NaN()
+		if fields[0] == "ID" {
+			continue
 		}
+		rows = append(rows, fields)
+	}
+	return rows
+}
 
-		data.Unit = line[5]
-		data.Event = strings.Trim(line[6], "'")
+// lineSeparator returns the column separator of a line of a sensor table,
+// whichever of '|' and ',' it holds more of.
+func lineSeparator(line string) string {
+	if strings.Count(line, "|") > strings.Count(line, ",") {
+		return "|"
+	}
+	return ","
+}
 
+// splitMonitoringOutput parses ipmimonitoring output. Lines that cannot be
+// parsed are skipped and their number returned alongside the sensors.
+func splitMonitoringOutput(impiOutput []byte) ([]sensorData, int) {
+	var result []sensorData
+	skipped := 0
+	for _, fields := range splitSensorTable(impiOutput, monitoringFields) {
+		data, err := parseMonitoringFields(fields)
+		if err != nil {
+			log.Debugf("Skipping ipmimonitoring line %q: %s", strings.Join(fields, ","), err)
+			skipped++
+			continue
+		}
 		result = append(result, data)
 	}
-	return result, err
+	return result, skipped
 }
 
-func getValue(ipmiOutput []byte, regex *regexp.Regexp) (string, error) {
-	for _, line := range strings.Split(string(ipmiOutput), "\n") {
-		match := regex.FindStringSubmatch(line)
-		if match == nil {
-			continue
+func parseMonitoringFields(fields []string) (sensorData, error) {
+	var data sensorData
+	if len(fields) < monitoringFields-1 {
+		return data, fmt.Errorf("expected %d columns, got %d", monitoringFields, len(fields))
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return data, err
+	}
+	data.ID = id
+	data.Name = fields[1]
+	data.Type = fields[2]
+	data.State = fields[3]
+	data.Value = math.NaN()
+	if fields[4] != "N/A" {
+		data.Value, err = strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return data, err
 		}
-		for i, name := range regex.SubexpNames() {
-			if name != "value" {
-				continue
+	}
+	data.Unit = fields[5]
+	if len(fields) == monitoringFields {
+		data.Events = splitEvents(fields[6])
+	}
+	return data, nil
+}
+
+// openQuote reports whether line ends inside a quoted event string.
+func openQuote(line string) bool {
+	quotes := strings.Count(line, "'") + strings.Count(line, "\u2018") + strings.Count(line, "\u2019")
+	return quotes%2 == 1
+}
+
+// splitEvents returns the quoted event strings of a sensor, like
+// 'Presence detected' 'Power Supply input lost (AC/DC)'. Text outside the
+// quotes is ignored.
+func splitEvents(field string) []string {
+	var events []string
+	if field == "" || field == "N/A" {
+		return events
+	}
+	if !strings.ContainsAny(field, "'\u2018\u2019") {
+		return []string{field}
+	}
+	var event strings.Builder
+	quoted := false
+	for _, r := range field {
+		switch {
+		case !quoted && (r == '\'' || r == '\u2018' || r == '\u2019'):
+			quoted = true
+		case quoted && (r == '\'' || r == '\u2019'):
+			quoted = false
+			if e := strings.TrimSpace(event.String()); e != "" {
+				events = append(events, e)
 			}
-			return match[i], nil
+			event.Reset()
+		case quoted:
+			event.WriteRune(r)
 		}
 	}
-	return "", fmt.Errorf("Could not find value in output: %s", string(ipmiOutput))
+	if e := strings.TrimSpace(event.String()); quoted && e != "" {
+		events = append(events, e)
+	}
+	return events
 }
 
-func getCurrentPowerConsumption(ipmiOutput []byte) (float64, error) {
-	value, err := getValue(ipmiOutput, ipmiDCMICurrentPowerRegex)
-	if err != nil {
-		return -1, err
+func sensorName(name string) string {
+	if len(strings.Fields(name)) > 1 {
+		name = strings.ReplaceAll(name, " ", "_")
+		name = strings.ReplaceAll(name, "/", "")
 	}
-	return strconv.ParseFloat(value, 64)
+	if strings.Index(name, "-") == 2 {
+		name = name[3:]
+		name = strings.ReplaceAll(name, "-", "_")
+	}
+	return name
 }
 
-func getChassis(ipmiOutput []byte, reg *regexp.Regexp) (float64, error) {
-	value, err := getValue(ipmiOutput, reg)
-	if err != nil {
-		return -1, err
+func splitKeyValueOutput(ipmiOutput []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(ipmiOutput), "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return values
+}
+
+func getChassis(status map[string]string, key string) (float64, error) {
+	value, ok := status[key]
+	if !ok {
+		return -1, fmt.Errorf("Could not find %s in chassis status", key)
 	}
 	if value == "on" || value == "false" {
-		return 1, err
+		return 1, nil
 	}
-	return 0, err
+	return 0, nil
 }
 
 // Describe implements Prometheus.Collector.
 func (c collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- sensorStateDesc
 	ch <- sensorValueDesc
+	ch <- sensorEventDesc
 	ch <- fanSpeedDesc
+	ch <- fanSpeedStateDesc
 	ch <- temperatureDesc
+	ch <- temperatureStateDesc
+	ch <- voltageDesc
+	ch <- voltageStateDesc
+	ch <- currentDesc
+	ch <- currentStateDesc
+	ch <- powerDesc
+	ch <- powerStateDesc
+	ch <- fanDutyCycleDesc
+	ch <- fanDutyCycleStateDesc
+	ch <- fanStateDesc
+	ch <- driveSlotStateDesc
+	ch <- powerSupplyStateDesc
+	ch <- memoryStateDesc
+	ch <- batteryStateDesc
 	ch <- powerConsumption
+	ch <- dcmiPowerMinimumDesc
+	ch <- dcmiPowerMaximumDesc
+	ch <- dcmiPowerAverageDesc
+	ch <- dcmiPowerPeriodDesc
+	ch <- dcmiPowerActiveDesc
+	ch <- chassisPowerState
+	ch <- chassisDriveFault
+	ch <- chassisCoolingFault
+	ch <- chassisRestorePolicyDesc
+	ch <- chassisLastPowerEventDesc
+	ch <- chassisIdentifyStateDesc
+	for _, desc := range chassisFlagDescs {
+		ch <- desc
+	}
+	ch <- bmcInfoDesc
+	ch <- bmcChannelInfoDesc
+	ch <- bmcChannelSessionsDesc
+	ch <- selEntriesDesc
+	ch <- selFreeSpaceDesc
+	ch <- selUsedPercentDesc
+	ch <- selLatestEntryDesc
+	ch <- selEventsDesc
+	ch <- fruInfoDesc
+	ch <- lastSuccessDesc
+	ch <- backoffDesc
+	ch <- consecutiveFailuresDesc
+	ch <- nextScrapeDesc
+	ch <- lastErrorDesc
+	ch <- sensorThresholdDesc
+	ch <- sensorHeadroomDesc
 	ch <- upDesc
 	ch <- durationDesc
 }
@@ -281,6 +523,7 @@ func collectTypedSensor(desc, stateDesc *prometheus.Desc, state float64, data se
 		data.Value,
 		strconv.FormatInt(data.ID, 10),
 		data.Name,
+		data.RawName,
 		target.Host,
 	))
 	sensorMetrics = append(sensorMetrics, prometheus.MustNewConstMetric(
@@ -289,6 +532,7 @@ func collectTypedSensor(desc, stateDesc *prometheus.Desc, state float64, data se
 		state,
 		strconv.FormatInt(data.ID, 10),
 		data.Name,
+		data.RawName,
 		target.Host,
 	))
 	return sensorMetrics
@@ -302,6 +546,7 @@ func collectGenericSensor(state float64, data sensorData, target ipmiTarget) []p
 		data.Value,
 		strconv.FormatInt(data.ID, 10),
 		data.Name,
+		data.RawName,
 		data.Type,
 		target.Host,
 	))
@@ -311,12 +556,51 @@ func collectGenericSensor(state float64, data sensorData, target ipmiTarget) []p
 		state,
 		strconv.FormatInt(data.ID, 10),
 		data.Name,
+		data.RawName,
 		data.Type,
 		target.Host,
 	))
 	return genericMetrics
 }
 
+// collectDiscreteSensor reports the state of a sensor without a reading.
+func collectDiscreteSensor(stateDesc *prometheus.Desc, state float64, data sensorData, target ipmiTarget) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		stateDesc,
+		prometheus.GaugeValue,
+		state,
+		strconv.FormatInt(data.ID, 10),
+		data.Name,
+		data.RawName,
+		target.Host,
+	)
+}
+
+// collectSensorEvents reports the events asserted by a sensor. The 'OK' that
+// ipmimonitoring prints for sensors without events is left out.
+func collectSensorEvents(data sensorData, target ipmiTarget) []prometheus.Metric {
+	var eventMetrics []prometheus.Metric
+	seen := make(map[string]bool)
+	for _, event := range data.Events {
+		if event == "OK" || seen[event] {
+			continue
+		}
+		seen[event] = true
+		eventMetrics = append(eventMetrics, prometheus.MustNewConstMetric(
+			sensorEventDesc,
+			prometheus.GaugeValue,
+			1,
+			strconv.FormatInt(data.ID, 10),
+			data.Name,
+			data.RawName,
+			data.Type,
+			event,
+			target.Host,
+		))
+	}
+	return eventMetrics
+}
+
 func readFile(filename string) ([]byte, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -325,26 +609,44 @@ func readFile(filename string) ([]byte, error) {
 	return data, err
 }
 
-func collectMonitoring(target ipmiTarget) (int, error, []prometheus.Metric) {
+func collectMonitoring(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
 	var monitorMetrics [] prometheus.Metric
-	output, err := ipmiOutput("ipmimonitoring", []string{
-		"-D", config.Global.Drive,
-		"-h", target.Host,
-		"-u", target.User,
-		"-p", target.Pwd,
-	})
-	//output, err := readFile("./file/hpipmi.txt")
-	if err != nil {
-		log.Errorf("Failed to collect ipmimonitoring data from %s: %s", target.Host, err)
-		return 0, err, nil
-	}
-	results, err := splitMonitoringOutput(output)
-	if err != nil {
-		log.Errorf("Failed to parse ipmimonitoring data from %s: %s", target.Host, err)
-		return 0, err, nil
+	var results []sensorData
+	var err error
+	if nativeTarget(target) {
+		results, err = nativeSensorData(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmimonitoring data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+	} else {
+		args := append(append([]string(nil), monitoringArgs...), target.module().SensorFilter.args()...)
+		output, err := freeipmiOutput(ctx, "ipmimonitoring", target, args...)
+		if err != nil {
+			log.Errorf("Failed to collect ipmimonitoring data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		var skipped int
+		results, skipped = splitMonitoringOutput(output)
+		if skipped > 0 {
+			sensorParseErrors.WithLabelValues(target.Host).Add(float64(skipped))
+			log.Warnf("Skipped %d unparsable ipmimonitoring lines from %s", skipped, target.Host)
+		}
+		if len(results) == 0 && skipped > 0 {
+			err = fmt.Errorf("none of %d ipmimonitoring lines could be parsed", skipped)
+			log.Errorf("Failed to parse ipmimonitoring data from %s: %s", target.Host, err)
+			return 0, parseError{err}, nil
+		}
 	}
+	namer := sensorNamer(target)
+	selected := sensorSelector(target)
 	for _, data := range results {
 		var state float64
+		if !selected(data.ID, data.Name, data.Type, data.State, data.Value) {
+			continue
+		}
+		data.RawName = data.Name
+		data.Name = namer(data.Name)
 
 		switch data.State {
 		case "Nominal":
@@ -378,56 +680,50 @@ func collectMonitoring(target ipmiTarget) (int, error, []prometheus.Metric) {
 		case "W":
 			monitorMetrics = append(monitorMetrics,
 				collectTypedSensor(powerDesc, powerStateDesc, state, data, target)...)
+		case "%":
+			if data.Type == "Fan" {
+				monitorMetrics = append(monitorMetrics,
+					collectTypedSensor(fanDutyCycleDesc, fanDutyCycleStateDesc, state, data, target)...)
+			} else {
+				monitorMetrics = append(monitorMetrics,
+					collectGenericSensor(state, data, target)...)
+			}
 		default:
-			monitorMetrics = append(monitorMetrics,
-				collectGenericSensor(state, data, target)...)
+			if stateDesc, ok := discreteStateDescs[data.Type]; ok && math.IsNaN(data.Value) {
+				monitorMetrics = append(monitorMetrics,
+					collectDiscreteSensor(stateDesc, state, data, target))
+			} else {
+				monitorMetrics = append(monitorMetrics,
+					collectGenericSensor(state, data, target)...)
+			}
 		}
+		monitorMetrics = append(monitorMetrics, collectSensorEvents(data, target)...)
 	}
 	return 1, nil, monitorMetrics
 }
 
-func collectDCMI(target ipmiTarget) (int, error, prometheus.Metric){
-	output, err := ipmiOutput("ipmi-dcmi", []string{
-		"-D", config.Global.Drive,
-		"-h", target.Host,
-		"-u", target.User,
-		"-p", target.Pwd,
-	})
-	//output, err := readFile("./file/hpdcmi.txt")
-	if err != nil {
-		log.Errorf("Failed to collect ipmi-dcmi data from %s: %s", target.Host, err)
-		return 0, err, nil
-	}
-	currentPowerConsumption, err := getCurrentPowerConsumption(output)
-	if err != nil {
-		log.Errorf("Failed to parse ipmi-dcmi data from %s: %s", target.Host, err)
-		return 0, err,nil
-	}
-	return 1, nil, prometheus.MustNewConstMetric(
-		powerConsumption,
-		prometheus.GaugeValue,
-		currentPowerConsumption,
-		target.Host,
-	)
-}
-
-func collectChassisState(target ipmiTarget) (int, error, []prometheus.Metric) {
+func collectChassisState(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
 	var chassMetrics [] prometheus.Metric
-	output, err := ipmiOutput("ipmi-chassis", []string{
-		"-D", config.Global.Drive,
-		"-h", target.Host,
-		"-u", target.User,
-		"-p", target.Pwd,
-	})
-	//output, err := readFile("./file/sugonchass.txt")
-	if err != nil {
-		log.Errorf("Failed to collect ipmi-chassis data from %s: %s", target.Host, err)
-		return 0, err,nil
+	var status map[string]string
+	if nativeTarget(target) {
+		var err error
+		status, err = nativeChassisStatus(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-chassis data from %s: %s", target.Host, err)
+			return 0, err,nil
+		}
+	} else {
+		output, err := freeipmiOutput(ctx, "ipmi-chassis", target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-chassis data from %s: %s", target.Host, err)
+			return 0, err,nil
+		}
+		status = splitKeyValueOutput(output)
 	}
-	currentChassisPowerState, err := getChassis(output, ipmiChassisPowerRegex)
+	currentChassisPowerState, err := getChassis(status, chassisPowerKey)
 	if err != nil {
 		log.Errorf("Failed to parse ipmi-chassis data from %s: %s", target.Host, err)
-		return 0, err,nil
+		return 0, parseError{err},nil
 	}
 	chassMetrics = append(chassMetrics, prometheus.MustNewConstMetric(
 		chassisPowerState,
@@ -436,10 +732,10 @@ func collectChassisState(target ipmiTarget) (int, error, []prometheus.Metric) {
 		target.Host,
 	))
 
-	currentChassisDriveFault, err := getChassis(output, ipmiChassisDriveRegex)
+	currentChassisDriveFault, err := getChassis(status, chassisDriveKey)
 	if err != nil {
 		log.Errorf("Failed to parse ipmi-chassis data from %s: %s", target.Host, err)
-		return 0, err,chassMetrics
+		return 0, parseError{err},chassMetrics
 	}
 	chassMetrics = append(chassMetrics, prometheus.MustNewConstMetric(
 		chassisDriveFault,
@@ -448,10 +744,10 @@ func collectChassisState(target ipmiTarget) (int, error, []prometheus.Metric) {
 		target.Host,
 	))
 
-	currentChassisCoolingFault, err := getChassis(output, ipmiChassisCollingRegex)
+	currentChassisCoolingFault, err := getChassis(status, chassisCoolingKey)
 	if err != nil {
 		log.Errorf("Failed to parse ipmi-chassis data from %s: %s", target.Host, err)
-		return 0, err,chassMetrics
+		return 0, parseError{err},chassMetrics
 	}
 	chassMetrics =append(chassMetrics, prometheus.MustNewConstMetric(
 		chassisCoolingFault,
@@ -459,6 +755,7 @@ func collectChassisState(target ipmiTarget) (int, error, []prometheus.Metric) {
 		currentChassisCoolingFault,
 		target.Host,
 	))
+	chassMetrics = append(chassMetrics, collectChassisFields(status, target)...)
 
 	return 1, nil,chassMetrics
 }
@@ -473,28 +770,86 @@ func markCollectorUp(name string, up int, target ipmiTarget) prometheus.Metric{
 	)
 }
 
-func IpmiCollect(target ipmiTarget) []prometheus.Metric {
+// scrapeStatus counts the collectors of a target that succeeded and failed.
+type scrapeStatus struct {
+	up, down int
+}
+
+// ok reports whether all collectors succeeded.
+func (s scrapeStatus) ok() bool {
+	return s.down == 0
+}
+
+// unreachable reports whether all collectors failed.
+func (s scrapeStatus) unreachable() bool {
+	return s.up == 0 && s.down > 0
+}
+
+// IpmiCollect runs the collectors of the target.
+func IpmiCollect(ctx context.Context, target ipmiTarget) ([]prometheus.Metric, scrapeStatus) {
 	var ipmiMetrics [] prometheus.Metric
+	var status scrapeStatus
 	start := time.Now()
-	for _, collector := range config.Global.Collector {
+	if *recordDir != "" && !target.Replay.enabled() {
+		target.recording = recordingDir(target, start)
+		pruneRecordings(target)
+	}
+	for _, collector := range target.module().Collector {
 		var up int
+		var err error
 		var collectMetcics []prometheus.Metric
-		var dcmiMetric prometheus.Metric
+		var dcmiMetrics []prometheus.Metric
 		var chassMetrics []prometheus.Metric
+		var bmcMetrics []prometheus.Metric
+		var selMetrics []prometheus.Metric
+		var fruMetrics []prometheus.Metric
+		var thresholdMetrics []prometheus.Metric
 		//log.Infof("Running collector: %s", collector)
+		if ctx.Err() != nil {
+			// The target ran out of time, keep what was collected so far.
+			ipmiMetrics = append(ipmiMetrics, markCollectorUp(collector, 0, target))
+			recordCollectorError(target.Host, collector, ctx.Err())
+			status.down++
+			continue
+		}
 		switch collector {
 		case "ipmimonitoring":
-			up, _,collectMetcics = collectMonitoring(target)
+			up, err, collectMetcics = collectMonitoring(ctx, target)
 			ipmiMetrics = append(ipmiMetrics, collectMetcics...)
 		case "ipmi-dcmi":
-			up, _,dcmiMetric = collectDCMI(target)
-			ipmiMetrics = append(ipmiMetrics, dcmiMetric)
+			up, err, dcmiMetrics = collectDCMI(ctx, target)
+			ipmiMetrics = append(ipmiMetrics, dcmiMetrics...)
 		case "ipmi-chassis":
-			up, _,chassMetrics  = collectChassisState(target)
+			up, err, chassMetrics = collectChassisState(ctx, target)
 			ipmiMetrics = append(ipmiMetrics, chassMetrics...)
+		case "bmc-info":
+			up, err, bmcMetrics = collectBMCInfo(ctx, target)
+			ipmiMetrics = append(ipmiMetrics, bmcMetrics...)
+		case "ipmi-sel":
+			up, err, selMetrics = collectSEL(ctx, target)
+			ipmiMetrics = append(ipmiMetrics, selMetrics...)
+		case "ipmi-fru":
+			up, err, fruMetrics = collectFRU(ctx, target)
+			ipmiMetrics = append(ipmiMetrics, fruMetrics...)
+		case "ipmi-sensors":
+			up, err, thresholdMetrics = collectSensorThresholds(ctx, target)
+			ipmiMetrics = append(ipmiMetrics, thresholdMetrics...)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			collectorTimeouts.WithLabelValues(collector, target.Host).Inc()
+		}
+		if up == 0 {
+			recordCollectorError(target.Host, collector, err)
+			status.down++
+		} else {
+			clearCollectorError(target.Host, collector)
+			status.up++
 		}
 		ipmiMetrics = append(ipmiMetrics, markCollectorUp(collector, up, target))
 	}
+	if nativeTarget(target) {
+		sessions.release(target)
+	}
 	//log.Info("ipmiMetrics:",len(ipmiMetrics))
 	duration := time.Since(start).Seconds()
 	//log.Debugf("Scrape of target %s took %f seconds.", target.Host, duration)
@@ -505,16 +860,33 @@ func IpmiCollect(target ipmiTarget) []prometheus.Metric {
 		target.Host,
 	)
 	ipmiMetrics = append(ipmiMetrics, durationMetrics)
-	return ipmiMetrics
+	return ipmiMetrics, status
 }
 
 // Collect implements Prometheus.Collector.
 func (c collector) Collect(ch chan<- prometheus.Metric) {
-	lock.RLock()
-	for _, metric := range metrics {
-		if metric != nil{
+	collectResults(ch)
+	collectSchedules(ch)
+	collectLastErrors(ch)
+}
+
+// Describe implements Prometheus.Collector.
+func (c targetCollector) Describe(ch chan<- *prometheus.Desc) {
+	collector{}.Describe(ch)
+}
+
+// Collect implements Prometheus.Collector.
+func (c targetCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	collected, status := IpmiCollect(c.ctx, c.target)
+	if c.store {
+		storeResult(c.target.Host, collected, status.ok())
+		recordScrape(c.target, start, baseInterval(c.target.settings()), status)
+	}
+	for _, metric := range collected {
+		if metric != nil {
 			ch <- metric
 		}
 	}
-	lock.RUnlock()
+	collectLastErrors(ch, c.target.Host)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	bmcManufacturerRegex = regexp.MustCompile(`^(?P<name>.*?)\s*\((?P<id>[0-9]+)\)$`)
+
+	bmcInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bmc", "info"),
+		"Constant metric with value '1' providing details about the BMC.",
+		[]string{"firmware_revision", "manufacturer_id", "manufacturer", "product_id", "ipmi_version", "guid", "host"},
+		nil,
+	)
+
+	bmcChannelInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bmc", "channel_info"),
+		"Constant metric with value '1' describing a BMC communication channel.",
+		[]string{"channel", "medium_type", "protocol_type", "session_support", "host"},
+		nil,
+	)
+
+	bmcChannelSessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bmc", "channel_active_sessions"),
+		"Number of active sessions on a BMC communication channel.",
+		[]string{"channel", "host"},
+		nil,
+	)
+)
+
+type bmcInfo struct {
+	device   map[string]string
+	channels []map[string]string
+}
+
+// splitBMCInfoOutput parses bmc-info output into the device section (which
+// includes the GUID) and one key/value map per channel.
+func splitBMCInfoOutput(ipmiOutput []byte) bmcInfo {
+	info := bmcInfo{device: make(map[string]string)}
+	var channel map[string]string
+	for _, line := range strings.Split(string(ipmiOutput), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "Channel Information" {
+			channel = make(map[string]string)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if channel == nil {
+			info.device[key] = value
+			continue
+		}
+		if key == "Channel Number" {
+			channel = map[string]string{key: value}
+			info.channels = append(info.channels, channel)
+			continue
+		}
+		channel[key] = value
+	}
+	return info
+}
+
+// splitManufacturer splits "Peppercon AG (10437)" into name and ID.
+func splitManufacturer(value string) (string, string) {
+	match := bmcManufacturerRegex.FindStringSubmatch(value)
+	if match == nil {
+		return "", value
+	}
+	return match[1], match[2]
+}
+
+func collectBMCInfo(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
+	var bmcMetrics []prometheus.Metric
+	var info bmcInfo
+	if nativeTarget(target) {
+		var err error
+		info, err = nativeBMCInfo(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect bmc-info data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+	} else {
+		output, err := freeipmiOutput(ctx, "bmc-info", target)
+		if err != nil {
+			log.Errorf("Failed to collect bmc-info data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		info = splitBMCInfoOutput(output)
+	}
+
+	manufacturer, manufacturerID := splitManufacturer(info.device["Manufacturer ID"])
+	bmcMetrics = append(bmcMetrics, prometheus.MustNewConstMetric(
+		bmcInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		info.device["Firmware Revision"],
+		manufacturerID,
+		manufacturer,
+		info.device["Product ID"],
+		info.device["IPMI Version"],
+		info.device["GUID"],
+		target.Host,
+	))
+	for _, channel := range info.channels {
+		number := channel["Channel Number"]
+		bmcMetrics = append(bmcMetrics, prometheus.MustNewConstMetric(
+			bmcChannelInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			number,
+			channel["Medium Type"],
+			channel["Protocol Type"],
+			channel["Session Support"],
+			target.Host,
+		))
+		active, err := strconv.ParseFloat(channel["Active Session Count"], 64)
+		if err != nil {
+			continue
+		}
+		bmcMetrics = append(bmcMetrics, prometheus.MustNewConstMetric(
+			bmcChannelSessionsDesc,
+			prometheus.GaugeValue,
+			active,
+			number,
+			target.Host,
+		))
+	}
+	return 1, nil, bmcMetrics
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	chassisRestorePolicyKey = "Power restore policy"
+	chassisLastEventKey     = "Last Power Event"
+	chassisIdentifyKey      = "Chassis Identify state"
+)
+
+var (
+	chassisRestorePolicyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "chassis", "power_restore_policy"),
+		"Power restore policy of the chassis, '1' for the current policy and '0' for the others.",
+		[]string{"policy", "host"},
+		nil,
+	)
+
+	chassisLastPowerEventDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "chassis", "last_power_event"),
+		"Cause of the last power event, '1' for the reported cause and '0' for the others.",
+		[]string{"event", "host"},
+		nil,
+	)
+
+	chassisIdentifyStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "chassis", "identify_state"),
+		"Chassis identify LED state, '1' for the current state and '0' for the others.",
+		[]string{"state", "host"},
+		nil,
+	)
+
+	// Values ipmi-chassis may print for the enum-style fields, so every
+	// state is exported even when it is not the current one.
+	restorePolicyValues  = []string{"Always off", "Restore", "Always on", "Unknown"}
+	lastPowerEventValues = []string{
+		"ac failed",
+		"power down due to power overload",
+		"power down due to interlock activated",
+		"power down due to power fault",
+		"power on via ipmi command",
+		"unknown",
+	}
+	identifyStateValues = []string{"off", "Timed on", "Indefinite on", "unknown"}
+
+	// chassisFlagDescs maps the boolean fields of the chassis status that
+	// have no metric of their own to their descriptors. Fields missing here
+	// are not exported.
+	chassisFlagDescs = map[string]*prometheus.Desc{
+		"Power overload":              newChassisFlagDesc("power_overload", "Power overload"),
+		"Interlock":                   newChassisFlagDesc("interlock", "Interlock"),
+		"Power fault":                 newChassisFlagDesc("power_fault", "Power fault"),
+		"Power control fault":         newChassisFlagDesc("power_control_fault", "Power control fault"),
+		"Chassis intrusion":           newChassisFlagDesc("intrusion", "Chassis intrusion"),
+		"Front panel lockout":         newChassisFlagDesc("front_panel_lockout", "Front panel lockout"),
+		"Power off button":            newChassisFlagDesc("power_off_button", "Power off button"),
+		"Reset button":                newChassisFlagDesc("reset_button", "Reset button"),
+		"Diagnostic Interrupt button": newChassisFlagDesc("diagnostic_interrupt_button", "Diagnostic Interrupt button"),
+		"Standby button":              newChassisFlagDesc("standby_button", "Standby button"),
+	}
+)
+
+func newChassisFlagDesc(name, key string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "chassis", name),
+		fmt.Sprintf("Chassis status field '%s' (1=true/active, 0=false/inactive).", key),
+		[]string{"host"},
+		nil,
+	)
+}
+
+// chassisFlag maps the boolean wordings used by ipmi-chassis to 1 or 0.
+func chassisFlag(value string) (float64, bool) {
+	switch strings.ToLower(value) {
+	case "true", "active", "on", "enabled", "yes":
+		return 1, true
+	case "false", "inactive", "off", "disabled", "no":
+		return 0, true
+	}
+	return 0, false
+}
+
+func collectChassisEnum(desc *prometheus.Desc, value string, values []string, target ipmiTarget) []prometheus.Metric {
+	var enumMetrics []prometheus.Metric
+	known := false
+	for _, v := range values {
+		state := 0.0
+		if v == value {
+			state = 1
+			known = true
+		}
+		enumMetrics = append(enumMetrics, prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			state,
+			v,
+			target.Host,
+		))
+	}
+	if !known {
+		enumMetrics = append(enumMetrics, prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			1,
+			value,
+			target.Host,
+		))
+	}
+	return enumMetrics
+}
+
+// collectChassisFields exports every field of the chassis status that is not
+// already covered by the power, drive fault and cooling fault metrics.
+func collectChassisFields(status map[string]string, target ipmiTarget) []prometheus.Metric {
+	var fieldMetrics []prometheus.Metric
+	keys := make([]string, 0, len(status))
+	for key := range status {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := status[key]
+		switch key {
+		case chassisPowerKey, chassisDriveKey, chassisCoolingKey:
+		case chassisRestorePolicyKey:
+			fieldMetrics = append(fieldMetrics,
+				collectChassisEnum(chassisRestorePolicyDesc, value, restorePolicyValues, target)...)
+		case chassisLastEventKey:
+			fieldMetrics = append(fieldMetrics,
+				collectChassisEnum(chassisLastPowerEventDesc, value, lastPowerEventValues, target)...)
+		case chassisIdentifyKey:
+			fieldMetrics = append(fieldMetrics,
+				collectChassisEnum(chassisIdentifyStateDesc, value, identifyStateValues, target)...)
+		default:
+			desc, known := chassisFlagDescs[key]
+			if !known {
+				log.Debugf("Ignoring unknown ipmi-chassis field %q", key)
+				continue
+			}
+			flag, ok := chassisFlag(value)
+			if !ok {
+				continue
+			}
+			fieldMetrics = append(fieldMetrics, prometheus.MustNewConstMetric(
+				desc,
+				prometheus.GaugeValue,
+				flag,
+				target.Host,
+			))
+		}
+	}
+	return fieldMetrics
+}
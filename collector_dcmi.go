@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	dcmiCurrentPowerKey = "Current Power"
+	dcmiMinimumPowerKey = "Minimum Power over sampling duration"
+	dcmiMaximumPowerKey = "Maximum Power over sampling duration"
+	dcmiAveragePowerKey = "Average Power over sampling duration"
+	dcmiPeriodKey       = "Statistics reporting time period"
+	dcmiMeasurementKey  = "Power Measurement"
+)
+
+var (
+	dcmiPowerMinimumDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dcmi", "power_minimum_watts"),
+		"Minimum power consumption over the sampling period in Watts.",
+		[]string{"host"},
+		nil,
+	)
+
+	dcmiPowerMaximumDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dcmi", "power_maximum_watts"),
+		"Maximum power consumption over the sampling period in Watts.",
+		[]string{"host"},
+		nil,
+	)
+
+	dcmiPowerAverageDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dcmi", "power_average_watts"),
+		"Average power consumption over the sampling period in Watts.",
+		[]string{"host"},
+		nil,
+	)
+
+	dcmiPowerPeriodDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dcmi", "power_sampling_period_seconds"),
+		"Length of the period the power statistics are reported over.",
+		[]string{"host"},
+		nil,
+	)
+
+	dcmiPowerActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dcmi", "power_measurement_active"),
+		"Whether the BMC reports power measurement as active (1) or not available (0).",
+		[]string{"host"},
+		nil,
+	)
+)
+
+// dcmiPower holds the power statistics of a BMC. Fields the BMC did not
+// report are NaN.
+type dcmiPower struct {
+	Current float64
+	Minimum float64
+	Maximum float64
+	Average float64
+	// Period is the statistics reporting period in seconds.
+	Period float64
+	Active bool
+}
+
+// dcmiWatts parses values like "88 Watts" or "126 watts".
+func dcmiWatts(values map[string]string, key string) (float64, error) {
+	value, ok := values[key]
+	if !ok {
+		return 0, fmt.Errorf("Could not find %s in ipmi-dcmi output", key)
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Empty value for %s in ipmi-dcmi output", key)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// splitDCMIOutput parses the power statistics printed by ipmi-dcmi. Only the
+// current power is required, the statistics that are missing or cannot be
+// parsed are left NaN. Older FreeIPMI versions do not print the measurement
+// state, in which case the measurement is assumed to be active.
+func splitDCMIOutput(ipmiOutput []byte) (dcmiPower, error) {
+	power := dcmiPower{Period: math.NaN(), Active: true}
+	values := splitKeyValueOutput(ipmiOutput)
+	var err error
+	power.Current, err = dcmiWatts(values, dcmiCurrentPowerKey)
+	if err != nil {
+		return power, err
+	}
+	for _, field := range []struct {
+		key   string
+		value *float64
+	}{
+		{dcmiMinimumPowerKey, &power.Minimum},
+		{dcmiMaximumPowerKey, &power.Maximum},
+		{dcmiAveragePowerKey, &power.Average},
+	} {
+		if *field.value, err = dcmiWatts(values, field.key); err != nil {
+			log.Debugf("Ignoring ipmi-dcmi %s: %s", field.key, err)
+			*field.value = math.NaN()
+		}
+	}
+	if period := strings.Fields(values[dcmiPeriodKey]); len(period) > 0 {
+		if ms, err := strconv.ParseFloat(period[0], 64); err == nil {
+			power.Period = ms / 1000
+		}
+	}
+	if state, ok := values[dcmiMeasurementKey]; ok {
+		power.Active = strings.EqualFold(state, "Active")
+	}
+	return power, nil
+}
+
+func collectDCMI(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
+	var dcmiMetrics []prometheus.Metric
+	var power dcmiPower
+	if nativeTarget(target) {
+		var err error
+		power, err = nativeDCMIPower(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-dcmi data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+	} else {
+		output, err := freeipmiOutput(ctx, "ipmi-dcmi", target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-dcmi data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		power, err = splitDCMIOutput(output)
+		if err != nil {
+			log.Errorf("Failed to parse ipmi-dcmi data from %s: %s", target.Host, err)
+			return 0, parseError{err}, nil
+		}
+	}
+
+	active := 0.0
+	if power.Active {
+		active = 1
+	}
+	dcmiMetrics = append(dcmiMetrics,
+		prometheus.MustNewConstMetric(dcmiPowerActiveDesc, prometheus.GaugeValue, active, target.Host),
+	)
+	if !math.IsNaN(power.Period) {
+		dcmiMetrics = append(dcmiMetrics,
+			prometheus.MustNewConstMetric(dcmiPowerPeriodDesc, prometheus.GaugeValue, power.Period, target.Host))
+	}
+	// BMCs without working power measurement report 0 W for everything,
+	// which would look like a real reading, so the values are left out.
+	if !power.Active {
+		return 1, nil, dcmiMetrics
+	}
+	dcmiMetrics = append(dcmiMetrics,
+		prometheus.MustNewConstMetric(powerConsumption, prometheus.GaugeValue, power.Current, target.Host))
+	// Statistics the BMC did not report are skipped rather than exported
+	// as 0 W.
+	for _, stat := range []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		{dcmiPowerMinimumDesc, power.Minimum},
+		{dcmiPowerMaximumDesc, power.Maximum},
+		{dcmiPowerAverageDesc, power.Average},
+	} {
+		if !math.IsNaN(stat.value) {
+			dcmiMetrics = append(dcmiMetrics,
+				prometheus.MustNewConstMetric(stat.desc, prometheus.GaugeValue, stat.value, target.Host))
+		}
+	}
+	return 1, nil, dcmiMetrics
+}
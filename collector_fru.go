@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	fruDefaultRefresh     = 3600
+	fruDateTimeLayout     = "01/02/06 - 15:04:05"
+	fruManufactureDateKey = "Board Manufacturing Date/Time"
+)
+
+var (
+	fruDeviceRegex = regexp.MustCompile(`^FRU Inventory Device: (?P<name>.*) \(ID (?P<id>[0-9A-Fa-f]+)h\)$`)
+
+	fruInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fru", "info"),
+		"Constant metric with value '1' providing the inventory data of a FRU device.",
+		append([]string{"fru", "id"}, append(fruLabels(), "host")...),
+		nil,
+	)
+
+	// fruFields maps the ipmi_fru_info labels to the ipmi-fru fields they are
+	// read from. DIMM FRUs only carry SPD data, which fills the product
+	// labels when the product area is missing.
+	fruFields = []struct {
+		label string
+		keys  []string
+	}{
+		{"chassis_type", []string{"Chassis Type"}},
+		{"chassis_part_number", []string{"Chassis Part Number"}},
+		{"chassis_serial_number", []string{"Chassis Serial Number"}},
+		{"board_manufacturer", []string{"Board Manufacturer"}},
+		{"board_product_name", []string{"Board Product Name"}},
+		{"board_serial_number", []string{"Board Serial Number"}},
+		{"board_part_number", []string{"Board Part Number"}},
+		{"board_manufacture_date", []string{fruManufactureDateKey}},
+		{"product_manufacturer", []string{"Product Manufacturer Name", "DIMM Manufacturer ID"}},
+		{"product_name", []string{"Product Name"}},
+		{"product_part_number", []string{"Product Part/Model Number", "DIMM Part Number"}},
+		{"product_version", []string{"Product Version"}},
+		{"product_serial_number", []string{"Product Serial Number", "DIMM Serial Number"}},
+	}
+
+	fruCache = struct {
+		sync.Mutex
+		entries map[string]fruCacheEntry
+	}{entries: make(map[string]fruCacheEntry)}
+)
+
+type fruDevice struct {
+	ID     string
+	Name   string
+	Fields map[string]string
+}
+
+type fruCacheEntry struct {
+	fetched time.Time
+	devices []fruDevice
+}
+
+func fruLabels() []string {
+	labels := make([]string, 0, len(fruFields))
+	for _, field := range fruFields {
+		labels = append(labels, field.label)
+	}
+	return labels
+}
+
+// fruRefresh returns how long FRU data of a target is served from the cache.
+func fruRefresh(target ipmiTarget) time.Duration {
+	refresh := target.settings().Global.FRU.Refresh
+	if refresh <= 0 {
+		refresh = fruDefaultRefresh
+	}
+	return time.Second * time.Duration(refresh)
+}
+
+// splitFRUOutput parses ipmi-fru output into one entry per FRU device. Field
+// keys are stored without the "FRU " prefix.
+func splitFRUOutput(ipmiOutput []byte) []fruDevice {
+	var devices []fruDevice
+	var device *fruDevice
+	for _, line := range strings.Split(string(ipmiOutput), "\n") {
+		line = strings.TrimSpace(line)
+		if match := fruDeviceRegex.FindStringSubmatch(line); match != nil {
+			id, err := strconv.ParseUint(match[2], 16, 8)
+			if err != nil {
+				device = nil
+				continue
+			}
+			devices = append(devices, fruDevice{
+				ID:     strconv.FormatUint(id, 10),
+				Name:   match[1],
+				Fields: make(map[string]string),
+			})
+			device = &devices[len(devices)-1]
+			continue
+		}
+		if device == nil || !strings.HasPrefix(line, "FRU ") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[len("FRU "):i])
+		value := strings.TrimSpace(line[i+1:])
+		if _, ok := device.Fields[key]; !ok && value != "" {
+			device.Fields[key] = value
+		}
+	}
+	return devices
+}
+
+func fetchFRU(ctx context.Context, target ipmiTarget) ([]fruDevice, error) {
+	if nativeTarget(target) {
+		return nativeFRU(ctx, target)
+	}
+	output, err := freeipmiOutput(ctx, "ipmi-fru", target)
+	if err != nil {
+		return nil, err
+	}
+	return splitFRUOutput(output), nil
+}
+
+// cachedFRU returns the FRU devices of a target, reading them from the BMC
+// only once per refresh period. If reading fails the previous inventory is
+// returned along with the error.
+func cachedFRU(ctx context.Context, target ipmiTarget) ([]fruDevice, error) {
+	fruCache.Lock()
+	entry, ok := fruCache.entries[target.Host]
+	fruCache.Unlock()
+	if ok && time.Since(entry.fetched) < fruRefresh(target) {
+		return entry.devices, nil
+	}
+	devices, err := fetchFRU(ctx, target)
+	if err != nil {
+		return entry.devices, err
+	}
+	fruCache.Lock()
+	fruCache.entries[target.Host] = fruCacheEntry{fetched: time.Now(), devices: devices}
+	fruCache.Unlock()
+	return devices, nil
+}
+
+// forgetFRU drops the cached inventory of a host.
+func forgetFRU(host string) {
+	fruCache.Lock()
+	delete(fruCache.entries, host)
+	fruCache.Unlock()
+}
+
+func collectFRU(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
+	var fruMetrics []prometheus.Metric
+	up := 1
+	devices, err := cachedFRU(ctx, target)
+	if err != nil {
+		log.Errorf("Failed to collect ipmi-fru data from %s: %s", target.Host, err)
+		up = 0
+	}
+	for _, device := range devices {
+		values := []string{device.Name, device.ID}
+		found := false
+		for _, field := range fruFields {
+			value := ""
+			for _, key := range field.keys {
+				if v, ok := device.Fields[key]; ok {
+					value = v
+					found = true
+					break
+				}
+			}
+			values = append(values, value)
+		}
+		if !found {
+			continue
+		}
+		values = append(values, target.Host)
+		fruMetrics = append(fruMetrics, prometheus.MustNewConstMetric(
+			fruInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			values...,
+		))
+	}
+	return up, err, fruMetrics
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestSplitFRUOutput(t *testing.T) {
+	hp, err := ioutil.ReadFile("file/hpfru.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		output  []byte
+		devices []fruDevice
+	}{
+		{
+			name:   "hp",
+			output: hp,
+			devices: []fruDevice{
+				{
+					ID:   "0",
+					Name: "Default FRU Device",
+					Fields: map[string]string{
+						"Chassis Type":              "Rack Mount Chassis",
+						"Chassis Part Number":       "868703-B21",
+						"Chassis Serial Number":     "CZJ91606XX",
+						fruManufactureDateKey:       "04/16/19 - 08:00:00",
+						"Board Manufacturer":        "HPE",
+						"Board Product Name":        "ProLiant DL380 Gen10",
+						"Board Serial Number":       "PWARB0ARHBS0XX",
+						"Board Part Number":         "875073-001",
+						"Product Manufacturer Name": "HPE",
+						"Product Name":              "ProLiant DL380 Gen10",
+						"Product Part/Model Number": "868703-B21",
+						"Product Serial Number":     "CZJ91606XX",
+					},
+				},
+				{
+					ID:   "1",
+					Name: "Power Supply 1",
+					Fields: map[string]string{
+						fruManufactureDateKey:   "12/03/18 - 00:00:00",
+						"Board Manufacturer":    "HPE",
+						"Board Product Name":    "800W FS Plat Ht Plg LH Pwr Sply Kit",
+						"Board Serial Number":   "5WBXK0DLLCX1XX",
+						"Board Part Number":     "865414-B21",
+						"Power Supply Capacity": "800 W",
+					},
+				},
+				{
+					ID:   "2",
+					Name: "Power Supply 2",
+					Fields: map[string]string{
+						"Error": "FRU Area Checksum Invalid",
+					},
+				},
+				{
+					ID:   "12",
+					Name: "PROC 1 DIMM 5",
+					Fields: map[string]string{
+						"DIMM Memory Type":     "DDR4 SDRAM",
+						"DIMM Size":            "32 GB",
+						"DIMM Manufacturer ID": "Samsung",
+						"DIMM Part Number":     "M393A4K40CB2-CVF",
+						"DIMM Serial Number":   "3A6C2AXX",
+					},
+				},
+			},
+		},
+		{
+			name:   "fields outside a device",
+			output: []byte("FRU Board Manufacturer: HPE\nFRU Inventory Device: PSU (ID 100h)\nFRU Board Manufacturer: HPE\n"),
+		},
+		{
+			name:   "repeated field",
+			output: []byte("FRU Inventory Device: Board (ID 1Ah)\nFRU Board Part Number: 875073-001\nFRU Board Part Number: 999999-001\n"),
+			devices: []fruDevice{
+				{ID: "26", Name: "Board", Fields: map[string]string{"Board Part Number": "875073-001"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		devices := splitFRUOutput(test.output)
+		if !reflect.DeepEqual(devices, test.devices) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", test.name, test.devices, devices)
+		}
+	}
+}
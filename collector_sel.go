@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	selEntryBytes      = 16
+	selDateTimeLayout  = "Jan-02-2006 15:04:05"
+	selEntriesKey      = "Number of log entries"
+	selFreeSpaceKey    = "Free space remaining"
+	selUnknownSeverity = "N/A"
+)
+
+var (
+	selEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sel", "entries"),
+		"Number of entries in the System Event Log.",
+		[]string{"host"},
+		nil,
+	)
+
+	selFreeSpaceDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sel", "free_space_bytes"),
+		"Free space remaining in the System Event Log in bytes.",
+		[]string{"host"},
+		nil,
+	)
+
+	selUsedPercentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sel", "used_percent"),
+		"Percentage of the System Event Log space in use.",
+		[]string{"host"},
+		nil,
+	)
+
+	selLatestEntryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sel", "latest_entry_timestamp_seconds"),
+		"Timestamp of the newest System Event Log entry.",
+		[]string{"host"},
+		nil,
+	)
+
+	selEventsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sel", "events"),
+		"Number of System Event Log entries by sensor type and event state.",
+		[]string{"type", "state", "host"},
+		nil,
+	)
+)
+
+type selEntry struct {
+	ID        int64
+	Timestamp time.Time
+	Name      string
+	Type      string
+	State     string
+	Event     string
+}
+
+type selLog struct {
+	Entries   float64
+	FreeBytes float64
+	Records   []selEntry
+}
+
+// splitSELInfoOutput reads the entry count and free space from
+// ipmi-sel --info output.
+func splitSELInfoOutput(ipmiOutput []byte) (selLog, error) {
+	sel := selLog{FreeBytes: math.NaN()}
+	values := splitKeyValueOutput(ipmiOutput)
+	entries, err := strconv.ParseFloat(values[selEntriesKey], 64)
+	if err != nil {
+		return sel, err
+	}
+	sel.Entries = entries
+	if free, ok := values[selFreeSpaceKey]; ok {
+		sel.FreeBytes, err = strconv.ParseFloat(strings.TrimSuffix(free, " bytes"), 64)
+		if err != nil {
+			return sel, err
+		}
+	}
+	return sel, nil
+}
+
+// splitSELOutput parses ipmi-sel --output-event-state output. Entries whose
+// timestamp is not known (e.g. "PostInit") get a zero Timestamp.
+func splitSELOutput(ipmiOutput []byte) []selEntry {
+	var result []selEntry
+	for _, line := range strings.Split(string(ipmiOutput), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 6 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		entry := selEntry{
+			ID:    id,
+			Name:  fields[3],
+			Type:  fields[4],
+			State: selUnknownSeverity,
+		}
+		if len(fields) >= 7 {
+			entry.State = fields[5]
+			entry.Event = strings.Join(fields[6:], "|")
+		} else {
+			entry.Event = fields[5]
+		}
+		if ts, err := time.Parse(selDateTimeLayout, fields[1]+" "+fields[2]); err == nil {
+			entry.Timestamp = ts
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func collectSEL(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
+	var selMetrics []prometheus.Metric
+	var sel selLog
+	if nativeTarget(target) {
+		var err error
+		sel, err = nativeSEL(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-sel data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+	} else {
+		output, err := freeipmiOutput(ctx, "ipmi-sel", target, "--info")
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-sel data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		sel, err = splitSELInfoOutput(output)
+		if err != nil {
+			log.Errorf("Failed to parse ipmi-sel data from %s: %s", target.Host, err)
+			return 0, parseError{err}, nil
+		}
+		output, err = freeipmiOutput(ctx, "ipmi-sel", target, "--output-event-state")
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-sel data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		sel.Records = splitSELOutput(output)
+	}
+
+	selMetrics = append(selMetrics, prometheus.MustNewConstMetric(
+		selEntriesDesc,
+		prometheus.GaugeValue,
+		sel.Entries,
+		target.Host,
+	))
+	if !math.IsNaN(sel.FreeBytes) {
+		used := sel.Entries * selEntryBytes
+		selMetrics = append(selMetrics, prometheus.MustNewConstMetric(
+			selFreeSpaceDesc,
+			prometheus.GaugeValue,
+			sel.FreeBytes,
+			target.Host,
+		))
+		if used+sel.FreeBytes > 0 {
+			selMetrics = append(selMetrics, prometheus.MustNewConstMetric(
+				selUsedPercentDesc,
+				prometheus.GaugeValue,
+				used/(used+sel.FreeBytes)*100,
+				target.Host,
+			))
+		}
+	}
+
+	var latest time.Time
+	type eventKey struct{ Type, State string }
+	events := make(map[eventKey]float64)
+	for _, entry := range sel.Records {
+		if entry.Timestamp.After(latest) {
+			latest = entry.Timestamp
+		}
+		events[eventKey{entry.Type, entry.State}]++
+	}
+	if !latest.IsZero() {
+		selMetrics = append(selMetrics, prometheus.MustNewConstMetric(
+			selLatestEntryDesc,
+			prometheus.GaugeValue,
+			float64(latest.Unix()),
+			target.Host,
+		))
+	}
+	for key, count := range events {
+		selMetrics = append(selMetrics, prometheus.MustNewConstMetric(
+			selEventsDesc,
+			prometheus.GaugeValue,
+			count,
+			key.Type,
+			key.State,
+			target.Host,
+		))
+	}
+	return 1, nil, selMetrics
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	output, err := ioutil.ReadFile("file/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestSplitSELInfoOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    []byte
+		entries   float64
+		freeBytes float64
+		err       bool
+	}{
+		{
+			name:      "hp",
+			output:    readFixture(t, "hpselinfo.txt"),
+			entries:   7,
+			freeBytes: 16272,
+		},
+		{
+			name:      "free space not reported",
+			output:    []byte("SEL version          : 1.5\nNumber of log entries : 3\n"),
+			entries:   3,
+			freeBytes: math.NaN(),
+		},
+		{
+			name:   "entries missing",
+			output: []byte("SEL version          : 1.5\nFree space remaining : 16272 bytes\n"),
+			err:    true,
+		},
+		{
+			name:   "free space unparsable",
+			output: []byte("Number of log entries : 3\nFree space remaining : lots\n"),
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		sel, err := splitSELInfoOutput(test.output)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", test.name, sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if sel.Entries != test.entries {
+			t.Errorf("%s: expected %v entries, got %v", test.name, test.entries, sel.Entries)
+		}
+		if sel.FreeBytes != test.freeBytes && !(math.IsNaN(sel.FreeBytes) && math.IsNaN(test.freeBytes)) {
+			t.Errorf("%s: expected %v free bytes, got %v", test.name, test.freeBytes, sel.FreeBytes)
+		}
+	}
+}
+
+func TestSplitSELOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  []byte
+		entries []selEntry
+	}{
+		{
+			name:   "hp",
+			output: readFixture(t, "hpsel.txt"),
+			entries: []selEntry{
+				{1, time.Date(2019, 1, 15, 8, 30, 2, 0, time.UTC), "SEL", "Event Logging Disabled", "Nominal", "Log Area Reset/Cleared"},
+				{2, time.Time{}, "Power Supply 1", "Power Supply", "Nominal", "Presence detected"},
+				{3, time.Date(2020, 3, 3, 11, 2, 17, 0, time.UTC), "Power Supply 2", "Power Supply", "Critical", "Power Supply input lost (AC/DC)"},
+				{4, time.Date(2020, 3, 3, 11, 2, 18, 0, time.UTC), "Power Supply 2", "Power Supply", "Critical", "Power Supply Failure detected"},
+				{5, time.Date(2020, 4, 21, 2, 45, 51, 0, time.UTC), "Fans", "Fan", "Warning", "Redundancy Degraded"},
+				{6, time.Date(2020, 4, 21, 2, 47, 9, 0, time.UTC), "Fans", "Fan", "Nominal", "Fully Redundant"},
+				{7, time.Date(2020, 7, 1, 15, 12, 43, 0, time.UTC), "01-Inlet Ambient", "Temperature", "Warning", "Upper Non-critical - going high ; Sensor Reading = 42.00 C ; Threshold = 42.00 C"},
+			},
+		},
+		{
+			name:   "without event state",
+			output: []byte("ID | Date        | Time     | Name | Type | Event\n9  | Jan-15-2019 | 08:30:02 | SEL  | Event Logging Disabled | Log Area Reset/Cleared\n"),
+			entries: []selEntry{
+				{9, time.Date(2019, 1, 15, 8, 30, 2, 0, time.UTC), "SEL", "Event Logging Disabled", selUnknownSeverity, "Log Area Reset/Cleared"},
+			},
+		},
+		{
+			name:   "event containing the separator",
+			output: []byte("3 | Mar-03-2020 | 11:02:17 | PS 2 | Power Supply | Critical | lost | AC\n"),
+			entries: []selEntry{
+				{3, time.Date(2020, 3, 3, 11, 2, 17, 0, time.UTC), "PS 2", "Power Supply", "Critical", "lost|AC"},
+			},
+		},
+		{
+			name:   "empty log",
+			output: []byte("ID | Date | Time | Name | Type | State | Event\n"),
+		},
+	}
+	for _, test := range tests {
+		entries := splitSELOutput(test.output)
+		if !reflect.DeepEqual(entries, test.entries) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", test.name, test.entries, entries)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sensorsFields is the number of columns printed by ipmi-sensors with
+// thresholds: ID, name, type, reading, units, the six thresholds and event.
+const sensorsFields = 12
+
+var (
+	sensorsArgs = []string{"--output-sensor-thresholds", "--comma-separated-output", "--no-header-output"}
+
+	// thresholdNames are the threshold labels in the column order of
+	// ipmi-sensors.
+	thresholdNames = []string{
+		"lower_non_recoverable",
+		"lower_critical",
+		"lower_non_critical",
+		"upper_non_critical",
+		"upper_critical",
+		"upper_non_recoverable",
+	}
+
+	sensorThresholdDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sensor", "threshold"),
+		"Threshold of an IPMI sensor, in the unit of its reading.",
+		[]string{"id", "name", "raw_name", "type", "threshold", "host"},
+		nil,
+	)
+
+	sensorHeadroomDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sensor", "critical_headroom"),
+		"Distance of a sensor reading to its nearest critical threshold, negative once it is crossed.",
+		[]string{"id", "name", "raw_name", "type", "host"},
+		nil,
+	)
+)
+
+type sensorThresholds struct {
+	ID   int64
+	Name string
+	// RawName is the name as printed by the BMC, Name the normalized one.
+	RawName string
+	Type    string
+	Value   float64
+	// Thresholds maps threshold names to values, only holding those the
+	// BMC reports.
+	Thresholds map[string]float64
+}
+
+// splitSensorsOutput parses ipmi-sensors output and returns the sensors
+// with at least one threshold. Lines that cannot be parsed are skipped and
+// their number returned alongside the sensors.
+func splitSensorsOutput(ipmiOutput []byte) ([]sensorThresholds, int) {
+	var result []sensorThresholds
+	skipped := 0
+	for _, fields := range splitSensorTable(ipmiOutput, sensorsFields) {
+		sensor, err := parseSensorsFields(fields)
+		if err != nil {
+			log.Debugf("Skipping ipmi-sensors line %q: %s", fields, err)
+			skipped++
+			continue
+		}
+		if len(sensor.Thresholds) > 0 {
+			result = append(result, sensor)
+		}
+	}
+	return result, skipped
+}
+
+func parseSensorsFields(fields []string) (sensorThresholds, error) {
+	sensor := sensorThresholds{Thresholds: make(map[string]float64)}
+	if len(fields) < sensorsFields-1 {
+		return sensor, fmt.Errorf("expected %d columns, got %d", sensorsFields, len(fields))
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sensor, err
+	}
+	sensor.ID = id
+	sensor.Name = fields[1]
+	sensor.Type = fields[2]
+	sensor.Value = math.NaN()
+	if fields[3] != "N/A" {
+		sensor.Value, err = strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return sensor, err
+		}
+	}
+	for i, name := range thresholdNames {
+		value := fields[5+i]
+		if value == "N/A" {
+			continue
+		}
+		sensor.Thresholds[name], err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return sensor, err
+		}
+	}
+	return sensor, nil
+}
+
+// criticalHeadroom returns the distance of the reading to the nearest
+// critical threshold. ok is false without a reading or critical threshold.
+func criticalHeadroom(sensor sensorThresholds) (headroom float64, ok bool) {
+	if math.IsNaN(sensor.Value) {
+		return 0, false
+	}
+	headroom = math.Inf(1)
+	if upper, found := sensor.Thresholds["upper_critical"]; found {
+		headroom = math.Min(headroom, upper-sensor.Value)
+		ok = true
+	}
+	if lower, found := sensor.Thresholds["lower_critical"]; found {
+		headroom = math.Min(headroom, sensor.Value-lower)
+		ok = true
+	}
+	return headroom, ok
+}
+
+func collectSensorThresholds(ctx context.Context, target ipmiTarget) (int, error, []prometheus.Metric) {
+	var thresholdMetrics []prometheus.Metric
+	var sensors []sensorThresholds
+	if nativeTarget(target) {
+		var err error
+		sensors, err = nativeSensorThresholds(ctx, target)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-sensors data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+	} else {
+		args := append(append([]string(nil), sensorsArgs...), target.module().SensorFilter.args()...)
+		output, err := freeipmiOutput(ctx, "ipmi-sensors", target, args...)
+		if err != nil {
+			log.Errorf("Failed to collect ipmi-sensors data from %s: %s", target.Host, err)
+			return 0, err, nil
+		}
+		var skipped int
+		sensors, skipped = splitSensorsOutput(output)
+		if skipped > 0 {
+			sensorParseErrors.WithLabelValues(target.Host).Add(float64(skipped))
+			log.Warnf("Skipped %d unparsable ipmi-sensors lines from %s", skipped, target.Host)
+		}
+		if len(sensors) == 0 && skipped > 0 {
+			err = fmt.Errorf("no thresholds in ipmi-sensors output, %d lines could not be parsed", skipped)
+			log.Errorf("Failed to parse ipmi-sensors data from %s: %s", target.Host, err)
+			return 0, parseError{err}, nil
+		}
+	}
+
+	namer := sensorNamer(target)
+	selected := sensorSelector(target)
+	for _, sensor := range sensors {
+		if !selected(sensor.ID, sensor.Name, sensor.Type, "", sensor.Value) {
+			continue
+		}
+		id := strconv.FormatInt(sensor.ID, 10)
+		sensor.RawName = sensor.Name
+		sensor.Name = namer(sensor.Name)
+		for _, name := range thresholdNames {
+			value, ok := sensor.Thresholds[name]
+			if !ok {
+				continue
+			}
+			thresholdMetrics = append(thresholdMetrics, prometheus.MustNewConstMetric(
+				sensorThresholdDesc,
+				prometheus.GaugeValue,
+				value,
+				id,
+				sensor.Name,
+				sensor.RawName,
+				sensor.Type,
+				name,
+				target.Host,
+			))
+		}
+		if headroom, ok := criticalHeadroom(sensor); ok {
+			thresholdMetrics = append(thresholdMetrics, prometheus.MustNewConstMetric(
+				sensorHeadroomDesc,
+				prometheus.GaugeValue,
+				headroom,
+				id,
+				sensor.Name,
+				sensor.RawName,
+				sensor.Type,
+				target.Host,
+			))
+		}
+	}
+	return 1, nil, thresholdMetrics
+}
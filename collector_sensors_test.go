@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSensorsOutput(t *testing.T) {
+	hp, err := ioutil.ReadFile("testdata/hpsensors.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		output  []byte
+		sensors []sensorThresholds
+		skipped int
+	}{
+		{
+			name:   "hp",
+			output: hp,
+			sensors: []sensorThresholds{
+				{ID: 2, Name: "01-Inlet Ambient", Type: "Temperature", Value: 19, Thresholds: map[string]float64{"upper_non_critical": 42, "upper_critical": 47}},
+				{ID: 3, Name: "02-CPU 1", Type: "Temperature", Value: 40, Thresholds: map[string]float64{"upper_non_critical": 70}},
+				{ID: 4, Name: "03-CPU 2", Type: "Temperature", Value: 40, Thresholds: map[string]float64{"upper_non_critical": 70}},
+				{ID: 5, Name: "04-P1 DIMM 1-4", Type: "Temperature", Value: 33, Thresholds: map[string]float64{"upper_non_critical": 90}},
+				{ID: 20, Name: "19-PCI 1", Type: "Temperature", Value: 72, Thresholds: map[string]float64{"upper_non_critical": 100}},
+				{ID: 32, Name: "32-Sys Exhaust", Type: "Temperature", Value: 38, Thresholds: map[string]float64{"upper_non_critical": 70, "upper_critical": 75}},
+			},
+		},
+		{
+			name:   "all thresholds",
+			output: []byte("10,P3V3,Voltage,3.17,V,2.80,2.97,3.04,3.56,3.63,3.80,'OK'\n"),
+			sensors: []sensorThresholds{
+				{ID: 10, Name: "P3V3", Type: "Voltage", Value: 3.17, Thresholds: map[string]float64{
+					"lower_non_recoverable": 2.80,
+					"lower_critical":        2.97,
+					"lower_non_critical":    3.04,
+					"upper_non_critical":    3.56,
+					"upper_critical":        3.63,
+					"upper_non_recoverable": 3.80,
+				}},
+			},
+		},
+		{
+			name:   "header and pipe separated",
+			output: []byte("ID | Name | Type | Reading | Units | Lower NR | Lower C | Lower NC | Upper NC | Upper C | Upper NR | Event\n11 | P12V | Voltage | 12.10 | V | N/A | 10.80 | N/A | N/A | 13.20 | N/A | 'OK'\n"),
+			sensors: []sensorThresholds{
+				{ID: 11, Name: "P12V", Type: "Voltage", Value: 12.1, Thresholds: map[string]float64{"lower_critical": 10.8, "upper_critical": 13.2}},
+			},
+		},
+		{
+			name:   "discrete sensors only",
+			output: []byte("35,Fan 1,Fan,N/A,N/A,N/A,N/A,N/A,N/A,N/A,N/A,'transition to Running'\n65,Fans,Fan,N/A,N/A,N/A,N/A,N/A,N/A,N/A,N/A,'Fully Redundant'\n"),
+		},
+		{
+			name:    "unparsable lines",
+			output:  []byte("x,P3V3,Voltage,3.17,V,N/A,2.97,N/A,N/A,3.63,N/A,'OK'\n12,P5V,Voltage,5.00,V,N/A,low,N/A,N/A,5.50,N/A,'OK'\n13,P1V8,Voltage\n"),
+			skipped: 3,
+		},
+	}
+	for _, test := range tests {
+		sensors, skipped := splitSensorsOutput(test.output)
+		if skipped != test.skipped {
+			t.Errorf("%s: expected %d skipped lines, got %d", test.name, test.skipped, skipped)
+		}
+		if !reflect.DeepEqual(sensors, test.sensors) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.sensors, sensors)
+		}
+	}
+}
+
+func TestSplitSensorsOutputNoReading(t *testing.T) {
+	sensors, skipped := splitSensorsOutput([]byte("70,Inlet Temp,Temperature,N/A,C,N/A,N/A,N/A,40.00,45.00,N/A,'N/A'\n"))
+	if skipped != 0 || len(sensors) != 1 {
+		t.Fatalf("expected one sensor, got %+v and %d skipped lines", sensors, skipped)
+	}
+	if !math.IsNaN(sensors[0].Value) {
+		t.Errorf("expected a missing reading to be NaN, got %v", sensors[0].Value)
+	}
+	if len(sensors[0].Thresholds) != 2 {
+		t.Errorf("expected 2 thresholds, got %v", sensors[0].Thresholds)
+	}
+}
+
+func TestCriticalHeadroom(t *testing.T) {
+	tests := []struct {
+		name     string
+		sensor   sensorThresholds
+		headroom float64
+		ok       bool
+	}{
+		{
+			name:     "upper critical",
+			sensor:   sensorThresholds{Value: 19, Thresholds: map[string]float64{"upper_non_critical": 42, "upper_critical": 47}},
+			headroom: 28,
+			ok:       true,
+		},
+		{
+			name:     "lower critical",
+			sensor:   sensorThresholds{Value: 3.1, Thresholds: map[string]float64{"lower_critical": 2.9}},
+			headroom: 0.2,
+			ok:       true,
+		},
+		{
+			name:     "nearest of lower and upper critical",
+			sensor:   sensorThresholds{Value: 3.17, Thresholds: map[string]float64{"lower_critical": 2.97, "upper_critical": 3.63}},
+			headroom: 0.2,
+			ok:       true,
+		},
+		{
+			name:     "upper critical crossed",
+			sensor:   sensorThresholds{Value: 50, Thresholds: map[string]float64{"upper_critical": 47}},
+			headroom: -3,
+			ok:       true,
+		},
+		{
+			name:     "lower critical crossed",
+			sensor:   sensorThresholds{Value: 10.5, Thresholds: map[string]float64{"lower_critical": 10.8, "upper_critical": 13.2}},
+			headroom: -0.3,
+			ok:       true,
+		},
+		{
+			name:   "only non-critical thresholds",
+			sensor: sensorThresholds{Value: 40, Thresholds: map[string]float64{"upper_non_critical": 70}},
+		},
+		{
+			name:   "no reading",
+			sensor: sensorThresholds{Value: math.NaN(), Thresholds: map[string]float64{"upper_critical": 45}},
+		},
+	}
+	for _, test := range tests {
+		headroom, ok := criticalHeadroom(test.sensor)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok=%t, got %t", test.name, test.ok, ok)
+			continue
+		}
+		if ok && math.Abs(headroom-test.headroom) > 1e-9 {
+			t.Errorf("%s: expected headroom %v, got %v", test.name, test.headroom, headroom)
+		}
+	}
+}
+
+func TestCollectSensorThresholdsUnparsable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipmi-sensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := []byte("x,P3V3,Voltage,3.17,V,N/A,2.97,N/A,N/A,3.63,N/A,'OK'\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "ipmi-sensors.txt"), output, 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := ipmiTarget{Host: "unparsable", Replay: replayConfig{Dir: dir}}
+	up, err, _ := collectSensorThresholds(context.Background(), target)
+	var parseErr parseError
+	if up != 0 || !errors.As(err, &parseErr) {
+		t.Errorf("expected a parse error, got up=%d and %v", up, err)
+	}
+}
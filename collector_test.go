@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSensorTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		rows   [][]string
+	}{
+		{
+			name:   "comma separated",
+			output: "2,01-Inlet Ambient,Temperature,Nominal,19.00,C,'OK'\n",
+			rows:   [][]string{{"2", "01-Inlet Ambient", "Temperature", "Nominal", "19.00", "C", "'OK'"}},
+		},
+		{
+			name:   "table with header",
+			output: "ID | Name | Type | State | Reading | Units | Event\n2 | 01-Inlet Ambient | Temperature | Nominal | 19.00 | C | 'OK'\n",
+			rows:   [][]string{{"2", "01-Inlet Ambient", "Temperature", "Nominal", "19.00", "C", "'OK'"}},
+		},
+		{
+			name:   "separator per line",
+			output: "2 | Inlet, front | Temperature | Nominal | 19.00 | C | 'OK'\n3,02-CPU 1,Temperature,Nominal,40.00,C,'OK'\n",
+			rows: [][]string{
+				{"2", "Inlet, front", "Temperature", "Nominal", "19.00", "C", "'OK'"},
+				{"3", "02-CPU 1", "Temperature", "Nominal", "40.00", "C", "'OK'"},
+			},
+		},
+		{
+			name:   "event continued on the next line",
+			output: "62 | Power Supply 2 | Power Supply | Critical | N/A | N/A | 'Presence detected' 'Power Supply\nFailure detected'\n",
+			rows:   [][]string{{"62", "Power Supply 2", "Power Supply", "Critical", "N/A", "N/A", "'Presence detected' 'Power Supply Failure detected'"}},
+		},
+	}
+	for _, test := range tests {
+		rows := splitSensorTable([]byte(test.output), monitoringFields)
+		if !reflect.DeepEqual(rows, test.rows) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.rows, rows)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	reasonAuth        = "auth"
+	reasonTimeout     = "timeout"
+	reasonUnreachable = "unreachable"
+	reasonUnsupported = "unsupported"
+	reasonParse       = "parse"
+	reasonNoFixture   = "no_fixture"
+	reasonUnknown     = "unknown"
+
+	redacted = "<redacted>"
+)
+
+var (
+	commandFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "command_failures_total",
+			Help:      "Number of failed FreeIPMI commands by command and failure reason.",
+		},
+		[]string{"command", "reason"},
+	)
+
+	// sensitiveFlags take a value that must not show up in logs or errors.
+	sensitiveFlags = map[string]bool{
+		"-u": true, "--username": true,
+		"-p": true, "--password": true,
+		"-k": true, "--k-g": true,
+	}
+
+	// failureMessages maps FreeIPMI error messages to failure reasons. The
+	// first match wins, so more specific messages come first.
+	failureMessages = []struct {
+		message string
+		reason  string
+	}{
+		{"username invalid", reasonAuth},
+		{"password invalid", reasonAuth},
+		{"k_g invalid", reasonAuth},
+		{"privilege level insufficient", reasonAuth},
+		{"privilege level cannot be obtained", reasonAuth},
+		{"authentication type unavailable", reasonAuth},
+		{"cipher suite id unavailable", reasonAuth},
+		{"connection timeout", reasonUnreachable},
+		{"session timeout", reasonUnreachable},
+		{"bmc busy", reasonUnreachable},
+		{"hostname invalid", reasonUnreachable},
+		{"invalid hostname", reasonUnreachable},
+		{"could not resolve", reasonUnreachable},
+		{"ipmi 2.0 unavailable", reasonUnsupported},
+		{"not supported", reasonUnsupported},
+		{"invalid command", reasonUnsupported},
+		{"command invalid", reasonUnsupported},
+	}
+)
+
+// commandError describes a failed command. Args and Stderr are redacted, so
+// the error can be logged as is.
+type commandError struct {
+	Command  string
+	Args     []string
+	ExitCode int
+	Duration time.Duration
+	Reason   string
+	Stderr   string
+	err      error
+}
+
+func (e *commandError) Error() string {
+	if e.Reason == reasonTimeout {
+		return fmt.Sprintf("%s killed after %s: %s", e.Command, e.Duration, e.err)
+	}
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s failed (%s): %s", e.Command, e.Reason, e.err)
+	}
+	return fmt.Sprintf("%s failed (%s): %s", e.Command, e.Reason, e.Stderr)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// classifyStderr maps the error output of a FreeIPMI tool to a failure
+// reason.
+func classifyStderr(stderr string) string {
+	stderr = strings.ToLower(stderr)
+	for _, m := range failureMessages {
+		if strings.Contains(stderr, m.message) {
+			return m.reason
+		}
+	}
+	return reasonUnknown
+}
+
+// redactArgs returns a copy of args with the values of sensitive flags
+// replaced, together with the values that were removed.
+func redactArgs(args []string) ([]string, []string) {
+	var secrets []string
+	out := make([]string, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		out[i] = arg
+		if sensitiveFlags[arg] && i+1 < len(args) {
+			i++
+			out[i] = redacted
+			secrets = append(secrets, args[i])
+			continue
+		}
+		if eq := strings.Index(arg, "="); eq > 0 && sensitiveFlags[arg[:eq]] {
+			out[i] = arg[:eq+1] + redacted
+			secrets = append(secrets, arg[eq+1:])
+		}
+	}
+	return out, secrets
+}
+
+// redactSecrets replaces every occurrence of secrets in s.
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
+
+// commandResult is the output of a command. Stderr is redacted, Stdout is
+// passed on as is for parsing.
+type commandResult struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// runProcessGroup runs cmd in its own process group and kills the whole group
+// once ctx is done, so a timeout also kills the children that would otherwise
+// keep the output pipes open. started is false if cmd could not be started.
+func runProcessGroup(ctx context.Context, cmd *exec.Cmd) (started bool, err error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	return true, err
+}
+
+// ipmiOutput runs the command name until ctx is done and returns its output.
+// Failures are returned as *commandError with the arguments, stderr and any
+// of the given secrets redacted.
+func ipmiOutput(ctx context.Context, name string, args []string, secrets ...string) (commandResult, error) {
+	safeArgs, argSecrets := redactArgs(args)
+	secrets = append(secrets, argSecrets...)
+	cmd := exec.Command(name, args...)
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	start := time.Now()
+	started, err := runProcessGroup(ctx, cmd)
+	if !started {
+		cmdErr := &commandError{Command: name, Args: safeArgs, ExitCode: -1, Reason: reasonUnknown, err: err}
+		commandFailures.WithLabelValues(name, cmdErr.Reason).Inc()
+		log.Debugf("Failed to start %s %s: %s", name, strings.Join(safeArgs, " "), err)
+		return commandResult{}, cmdErr
+	}
+	duration := time.Since(start)
+	exitCode := cmd.ProcessState.ExitCode()
+	log.Debugf("Ran %s %s: exit code %d after %s", name, strings.Join(safeArgs, " "), exitCode, duration)
+
+	result := commandResult{
+		Stdout: out.Bytes(),
+		Stderr: []byte(redactSecrets(stderr.String(), secrets)),
+	}
+	var reason string
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+		reason = reasonTimeout
+	case err != nil:
+		reason = classifyStderr(stderr.String())
+	default:
+		return result, nil
+	}
+	commandFailures.WithLabelValues(name, reason).Inc()
+	return result, &commandError{
+		Command:  name,
+		Args:     safeArgs,
+		ExitCode: exitCode,
+		Duration: duration,
+		Reason:   reason,
+		Stderr:   strings.TrimSpace(string(result.Stderr)),
+		err:      err,
+	}
+}
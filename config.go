@@ -1,18 +1,141 @@
 package main
 
+// ipmiModule groups the settings that may differ between BMC models. Empty
+// fields fall back to the global settings.
+type ipmiModule struct {
+	Collector []string
+	Drive     string
+	// Privilege is a FreeIPMI privilege level, e.g. USER or ADMIN.
+	Privilege   string
+	CipherSuite *int `yaml:"cipher_suite"`
+	// Args are passed as-is to every FreeIPMI tool.
+	Args []string
+	// Interval in seconds at which the target is collected, rounded up to
+	// a multiple of the global interval at which collection cycles run.
+	Interval     int
+	SensorNames  *sensorNaming `yaml:"sensor_names"`
+	SensorFilter *sensorFilter `yaml:"sensor_filter"`
+}
+
 type ipmiTarget struct {
-	Host   string
-	User   string
-	Pwd    string
+	Host string
+	User string
+	Pwd  string
+	// Alternatives to a plaintext Pwd, at most one source may be set.
+	PwdFile    string `yaml:"pwd_file"`
+	PwdEnv     string `yaml:"pwd_env"`
+	PwdCommand string `yaml:"pwd_command"`
+	Module     string
+	// Replay reads FreeIPMI output from fixtures instead of the BMC.
+	Replay replayConfig
+	// Settings set on the target override those of its module.
+	ipmiModule `yaml:",inline"`
+
+	// password is resolved from the configured source when loading.
+	password string
+	// recording is the directory the running collection is recorded into,
+	// empty unless --record.dir is set.
+	recording string
+	// config is the configuration the target was loaded with. Collections
+	// use it throughout, so a reload does not change settings midway.
+	config *Config
 }
 
 type Config struct {
 	Global struct{
 		Address string
 		Drive         string
+		Backend       string
 		Interval      string
 		Collector   []string
 		TimeOut       int
+		// CommandTimeOut bounds each FreeIPMI command, TimeOut a whole target.
+		CommandTimeOut int `yaml:"command_timeout"`
+		// Concurrency limits the targets collected at once, Jitter spreads
+		// their start over that many seconds.
+		Concurrency   int
+		Jitter        int
+		// Staleness is how long a cached result is served, 0 for no limit.
+		Staleness     int
+		// MaxBackoff caps the delay in seconds between collections of a
+		// target that keeps failing.
+		MaxBackoff    int `yaml:"max_backoff"`
+		Session       struct {
+			Persistent bool
+			KeepAlive  int
+		}
+		FRU           struct {
+			Refresh int
+		}
+		SensorNames  *sensorNaming `yaml:"sensor_names"`
+		SensorFilter *sensorFilter `yaml:"sensor_filter"`
 	}
+	Modules map[string]ipmiModule
 	Targets []ipmiTarget
 }
+
+// merge overrides the settings of m with those set in o.
+func (m *ipmiModule) merge(o ipmiModule) {
+	if o.Collector != nil {
+		m.Collector = o.Collector
+	}
+	if o.Drive != "" {
+		m.Drive = o.Drive
+	}
+	if o.Privilege != "" {
+		m.Privilege = o.Privilege
+	}
+	if o.CipherSuite != nil {
+		m.CipherSuite = o.CipherSuite
+	}
+	if o.Args != nil {
+		m.Args = o.Args
+	}
+	if o.Interval > 0 {
+		m.Interval = o.Interval
+	}
+	if o.SensorNames != nil {
+		m.SensorNames = o.SensorNames
+	}
+	if o.SensorFilter != nil {
+		m.SensorFilter = o.SensorFilter
+	}
+}
+
+// module returns the settings that apply to the target: the global ones,
+// overridden by the target's module and then by the target itself.
+func (t ipmiTarget) module() ipmiModule {
+	return t.settings().module(t)
+}
+
+// settings returns the configuration the target was loaded with, or the
+// current one for targets that were not loaded from a config file.
+func (t ipmiTarget) settings() *Config {
+	if t.config != nil {
+		return t.config
+	}
+	return currentConfig()
+}
+
+// currentConfig returns the configuration in use. It is replaced as a whole
+// on reload and never modified, so it can be read without holding lock.
+func currentConfig() *Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// module returns the settings of c that apply to the target.
+func (c *Config) module(t ipmiTarget) ipmiModule {
+	m := ipmiModule{
+		Collector:    c.Global.Collector,
+		Drive:        c.Global.Drive,
+		SensorNames:  c.Global.SensorNames,
+		SensorFilter: c.Global.SensorFilter,
+	}
+	if named, ok := c.Modules[t.Module]; ok {
+		m.merge(named)
+	}
+	m.merge(t.ipmiModule)
+	return m
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultPwdCommandTimeout bounds a pwd_command when no command_timeout is
+// configured, so a hanging secret helper cannot block loading the config.
+const defaultPwdCommandTimeout = 10 * time.Second
+
+// resolvePassword reads the BMC password of the target from the source set
+// in the config, running a pwd_command for at most timeout. Errors never
+// include the password itself.
+func resolvePassword(t ipmiTarget, timeout time.Duration) (string, error) {
+	sources := 0
+	for _, source := range []string{t.Pwd, t.PwdFile, t.PwdEnv, t.PwdCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("target %s sets more than one of pwd, pwd_file, pwd_env and pwd_command", t.Host)
+	}
+	switch {
+	case t.PwdFile != "":
+		pwd, err := ioutil.ReadFile(t.PwdFile)
+		if err != nil {
+			return "", fmt.Errorf("read pwd_file of target %s: %w", t.Host, err)
+		}
+		return strings.TrimRight(string(pwd), "\r\n"), nil
+	case t.PwdEnv != "":
+		pwd, ok := os.LookupEnv(t.PwdEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s of target %s is not set", t.PwdEnv, t.Host)
+		}
+		return pwd, nil
+	case t.PwdCommand != "":
+		return runPwdCommand(t, timeout)
+	}
+	return t.Pwd, nil
+}
+
+// runPwdCommand runs the pwd_command of the target and returns its output.
+// The command text and anything it printed on stdout are redacted from the
+// stderr included in errors, as either might hold the secret.
+func runPwdCommand(t ipmiTarget, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.Command("/bin/sh", "-c", t.PwdCommand)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	_, err := runProcessGroup(ctx, cmd)
+	pwd := strings.TrimRight(stdout.String(), "\r\n")
+	switch {
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("pwd_command of target %s killed after %s", t.Host, timeout)
+	case err != nil:
+		msg := strings.TrimSpace(redactSecrets(stderr.String(), []string{t.PwdCommand, pwd}))
+		if msg == "" {
+			return "", fmt.Errorf("pwd_command of target %s failed: %s", t.Host, err)
+		}
+		return "", fmt.Errorf("pwd_command of target %s failed: %s: %s", t.Host, err, msg)
+	}
+	return pwd, nil
+}
+
+// resolvePasswords resolves the passwords of all targets of c. Targets whose
+// password cannot be resolved are left without one and the first error is
+// returned.
+func resolvePasswords(c *Config) error {
+	timeout := defaultPwdCommandTimeout
+	if c.Global.CommandTimeOut > 0 {
+		timeout = time.Second * time.Duration(c.Global.CommandTimeOut)
+	}
+	var firstErr error
+	for i := range c.Targets {
+		pwd, err := resolvePassword(c.Targets[i], timeout)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		c.Targets[i].password = pwd
+	}
+	return firstErr
+}
+
+// freeipmiConfigFile writes the password of the target to a temporary
+// FreeIPMI config file that only the exporter can read. The caller removes
+// the file.
+func freeipmiConfigFile(target ipmiTarget) (string, error) {
+	f, err := ioutil.TempFile("", "ipmi_exporter-")
+	if err != nil {
+		return "", err
+	}
+	if target.password != "" {
+		_, err = fmt.Fprintf(f, "password %s\n", freeipmiQuote(target.password))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// freeipmiQuote quotes values FreeIPMI would otherwise split or cut at a
+// comment sign.
+func freeipmiQuote(value string) string {
+	if strings.ContainsAny(value, " \t#\"") {
+		return `"` + strings.Replace(value, `"`, `\"`, -1) + `"`
+	}
+	return value
+}
+
+// freeipmiOutput runs a FreeIPMI tool against the target. The password is
+// handed over in a config file instead of on the command line, where every
+// user could read it from the process list.
+func freeipmiOutput(ctx context.Context, name string, target ipmiTarget, extra ...string) ([]byte, error) {
+	if target.Replay.enabled() {
+		return replayOutput(target, name, extra)
+	}
+	configFile, err := freeipmiConfigFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("write FreeIPMI config file: %w", err)
+	}
+	defer os.Remove(configFile)
+	args := append([]string{"--config-file", configFile}, freeipmiArgs(target, extra...)...)
+	ctx, cancel := commandContext(ctx, target)
+	defer cancel()
+	result, err := ipmiOutput(ctx, name, args, target.password)
+	if target.recording != "" {
+		recordOutput(target, fixtureName(name, extra), result, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Stdout, nil
+}
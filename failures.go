@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/soundcloud/ipmi_exporter/ipmi"
+)
+
+var (
+	scrapeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scrape",
+			Name:      "errors_total",
+			Help:      "Number of failed collector runs by failure reason.",
+		},
+		[]string{"host", "collector", "reason"},
+	)
+
+	lastErrorDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "last_error_info"),
+		"Reason of the failure of a collector that has not succeeded since, always 1.",
+		[]string{"host", "collector", "reason"},
+		nil,
+	)
+
+	lastErrors = struct {
+		sync.Mutex
+		reasons map[string]map[string]string
+	}{reasons: make(map[string]map[string]string)}
+)
+
+// parseError marks an error in the output of a tool, as opposed to a failure
+// to run it.
+type parseError struct {
+	err error
+}
+
+func (e parseError) Error() string {
+	return e.err.Error()
+}
+
+func (e parseError) Unwrap() error {
+	return e.err
+}
+
+// failureReason returns the reason a collector failed with err, one of the
+// reason constants.
+func failureReason(err error) string {
+	var cmdErr *commandError
+	var parseErr parseError
+	var fixtureErr *missingFixtureError
+	var code ipmi.CompletionCode
+	var netErr *net.OpError
+	switch {
+	case err == nil:
+		return reasonUnknown
+	case errors.As(err, &cmdErr):
+		return cmdErr.Reason
+	case errors.As(err, &parseErr):
+		return reasonParse
+	case errors.As(err, &fixtureErr):
+		return reasonNoFixture
+	case errors.Is(err, context.DeadlineExceeded):
+		return reasonTimeout
+	case errors.Is(err, ipmi.ErrAuthentication):
+		return reasonAuth
+	case errors.Is(err, ipmi.ErrTimeout), errors.As(err, &netErr):
+		return reasonUnreachable
+	case errors.As(err, &code):
+		switch code {
+		case ipmi.CompletionInvalidCommand:
+			return reasonUnsupported
+		case ipmi.CompletionInsufficientPriv:
+			return reasonAuth
+		}
+	}
+	return reasonUnknown
+}
+
+// recordCollectorError counts a failed collector run on host.
+func recordCollectorError(host, collector string, err error) {
+	reason := failureReason(err)
+	scrapeErrors.WithLabelValues(host, collector, reason).Inc()
+	lastErrors.Lock()
+	defer lastErrors.Unlock()
+	if lastErrors.reasons[host] == nil {
+		lastErrors.reasons[host] = make(map[string]string)
+	}
+	lastErrors.reasons[host][collector] = reason
+}
+
+// clearCollectorError drops the last failure reason of a collector that
+// succeeded again, so ipmi_last_error_info only shows current failures.
+func clearCollectorError(host, collector string) {
+	lastErrors.Lock()
+	defer lastErrors.Unlock()
+	delete(lastErrors.reasons[host], collector)
+	if len(lastErrors.reasons[host]) == 0 {
+		delete(lastErrors.reasons, host)
+	}
+}
+
+// forgetLastErrors drops the failure reasons of a host removed from the
+// configuration.
+func forgetLastErrors(host string) {
+	lastErrors.Lock()
+	delete(lastErrors.reasons, host)
+	lastErrors.Unlock()
+}
+
+// collectLastErrors sends the last failure reason of every collector of the
+// given hosts, or of all hosts if none are given.
+func collectLastErrors(ch chan<- prometheus.Metric, hosts ...string) {
+	lastErrors.Lock()
+	defer lastErrors.Unlock()
+	if len(hosts) == 0 {
+		for host := range lastErrors.reasons {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, host := range hosts {
+		for collector, reason := range lastErrors.reasons[host] {
+			ch <- prometheus.MustNewConstMetric(lastErrorDesc, prometheus.GaugeValue, 1, host, collector, reason)
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cmdGetChannelAuthCaps    = 0x38
+	cmdSetSessionPrivilege   = 0x3b
+	cmdCloseSession          = 0x3c
+	defaultPort              = "623"
+	maxUsernameLength        = 16
+	maxPasswordLength        = 20
+	channelAuthCapsExtended  = 0x80
+	channelCurrent           = 0x0e
+	channelAuthCapsIPMI20Bit = 0x02
+)
+
+var (
+	// ErrTimeout is returned when the BMC does not answer within the
+	// configured timeout and number of retries.
+	ErrTimeout = errors.New("timeout waiting for BMC response")
+	// ErrAuthentication is returned when the BMC's RAKP key exchange
+	// authentication code does not match, usually due to a wrong password.
+	ErrAuthentication = errors.New("RAKP authentication code mismatch (wrong password?)")
+	// ErrSessionClosed is returned when executing a command without an
+	// active session.
+	ErrSessionClosed = errors.New("session is not active")
+)
+
+// PrivilegeLevel is the session privilege level requested from the BMC.
+type PrivilegeLevel uint8
+
+const (
+	PrivilegeCallback      PrivilegeLevel = 0x01
+	PrivilegeUser          PrivilegeLevel = 0x02
+	PrivilegeOperator      PrivilegeLevel = 0x03
+	PrivilegeAdministrator PrivilegeLevel = 0x04
+)
+
+// ParsePrivilegeLevel accepts the privilege level names used by FreeIPMI's
+// --privilege-level option.
+func ParsePrivilegeLevel(s string) (PrivilegeLevel, error) {
+	switch strings.ToLower(s) {
+	case "callback":
+		return PrivilegeCallback, nil
+	case "", "user":
+		return PrivilegeUser, nil
+	case "operator":
+		return PrivilegeOperator, nil
+	case "admin", "administrator":
+		return PrivilegeAdministrator, nil
+	}
+	return 0, fmt.Errorf("unknown privilege level %q", s)
+}
+
+// StatusCode is an RMCP+ status code returned during session setup.
+type StatusCode uint8
+
+var statusMessages = map[StatusCode]string{
+	0x01: "insufficient resources to create a session",
+	0x02: "invalid session ID",
+	0x03: "invalid payload type",
+	0x04: "invalid authentication algorithm",
+	0x05: "invalid integrity algorithm",
+	0x06: "no matching authentication payload",
+	0x07: "no matching integrity payload",
+	0x08: "inactive session ID",
+	0x09: "invalid role",
+	0x0a: "unauthorized role or privilege level requested",
+	0x0b: "insufficient resources to create a session at the requested role",
+	0x0c: "invalid name length",
+	0x0d: "unauthorized name",
+	0x0e: "unauthorized GUID",
+	0x0f: "invalid integrity check value",
+	0x10: "invalid confidentiality algorithm",
+	0x11: "no cipher suite match with proposed security algorithms",
+	0x12: "illegal or unrecognized parameter",
+}
+
+func (s StatusCode) Error() string {
+	if msg, ok := statusMessages[s]; ok {
+		return msg
+	}
+	return fmt.Sprintf("RMCP+ status code 0x%02x", uint8(s))
+}
+
+// Client is an IPMI 2.0 LAN session with a single BMC. It is safe for
+// concurrent use; commands are serialized over the session.
+type Client struct {
+	// Host is the BMC address, optionally with a port (default 623).
+	Host        string
+	Username    string
+	Password    string
+	Privilege   PrivilegeLevel
+	CipherSuite int
+	// Timeout bounds a single request attempt, Retries is the number of
+	// retransmissions before giving up.
+	Timeout time.Duration
+	Retries int
+
+	mu        sync.Mutex
+	conn      net.Conn
+	keys      *keys
+	consoleID uint32
+	managedID uint32
+	sequence  uint32
+	rqSeq     uint8
+	active    bool
+}
+
+// NewClient returns a client using cipher suite 3 at user privilege.
+func NewClient(host, username, password string) *Client {
+	return &Client{
+		Host:        host,
+		Username:    username,
+		Password:    password,
+		Privilege:   PrivilegeUser,
+		CipherSuite: 3,
+		Timeout:     2 * time.Second,
+		Retries:     2,
+	}
+}
+
+// Active reports whether the client holds an established session.
+func (c *Client) Active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// Open establishes an RMCP+ session using the RAKP key exchange.
+func (c *Client) Open(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active {
+		return nil
+	}
+	suite, ok := cipherSuites[c.CipherSuite]
+	if !ok {
+		return fmt.Errorf("unsupported cipher suite %d", c.CipherSuite)
+	}
+	if len(c.Username) > maxUsernameLength {
+		return errors.New("username longer than 16 bytes")
+	}
+	if len(c.Password) > maxPasswordLength {
+		return errors.New("password longer than 20 bytes")
+	}
+	addr := c.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.consoleID = 0
+	c.sequence = 0
+	c.rqSeq = 0
+	if err := c.handshake(ctx, suite); err != nil {
+		c.active = false
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close ends the session with the BMC and releases the socket.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	if c.active {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		id := make([]byte, 4)
+		binary.LittleEndian.PutUint32(id, c.managedID)
+		c.execute(ctx, NetFnApp, 0, cmdCloseSession, id)
+		cancel()
+		c.active = false
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Execute sends an IPMI request to LUN 0 of the BMC and returns the response
+// data following the completion code.
+func (c *Client) Execute(ctx context.Context, netFn, cmd uint8, data []byte) ([]byte, error) {
+	return c.ExecuteLUN(ctx, netFn, 0, cmd, data)
+}
+
+// ExecuteLUN is like Execute but addresses the given LUN.
+func (c *Client) ExecuteLUN(ctx context.Context, netFn, lun, cmd uint8, data []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.active {
+		return nil, ErrSessionClosed
+	}
+	return c.execute(ctx, netFn, lun, cmd, data)
+}
+
+func (c *Client) handshake(ctx context.Context, suite cipherSuite) error {
+	if err := c.channelAuthCapabilities(ctx); err != nil {
+		return fmt.Errorf("get channel authentication capabilities: %w", err)
+	}
+
+	consoleID := make([]byte, 4)
+	for c.consoleID == 0 {
+		if _, err := randRead(consoleID); err != nil {
+			return err
+		}
+		c.consoleID = binary.LittleEndian.Uint32(consoleID)
+	}
+	binary.LittleEndian.PutUint32(consoleID, c.consoleID)
+
+	const tag = 0x00
+	req := make([]byte, 32)
+	req[0] = tag
+	req[1] = uint8(c.Privilege)
+	copy(req[4:8], consoleID)
+	req[8], req[11], req[12] = 0x00, 0x08, suite.auth
+	req[16], req[19], req[20] = 0x01, 0x08, suite.integrity
+	req[24], req[27], req[28] = 0x02, 0x08, suite.confidentiality
+	resp, err := c.sessionSetup(ctx, payloadOpenSessionReq, payloadOpenSessionResp, req)
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	if len(resp) < 36 {
+		return fmt.Errorf("open session: %s", errShortPacket)
+	}
+	if !bytes.Equal(resp[4:8], consoleID) {
+		return errors.New("open session: remote console session ID mismatch")
+	}
+	if resp[16] != suite.auth || resp[24] != suite.integrity || resp[32] != suite.confidentiality {
+		return errors.New("open session: BMC selected different algorithms than requested")
+	}
+	managedID := append([]byte(nil), resp[8:12]...)
+	c.managedID = binary.LittleEndian.Uint32(managedID)
+
+	rm := make([]byte, 16)
+	if _, err := randRead(rm); err != nil {
+		return err
+	}
+	// Role: requested privilege with username/privilege lookup.
+	roleName := []byte{uint8(c.Privilege), uint8(len(c.Username))}
+	roleName = append(roleName, c.Username...)
+	rakp1 := []byte{tag, 0, 0, 0}
+	rakp1 = append(rakp1, managedID...)
+	rakp1 = append(rakp1, rm...)
+	rakp1 = append(rakp1, roleName[0], 0, 0)
+	rakp1 = append(rakp1, roleName[1:]...)
+	resp, err = c.sessionSetup(ctx, payloadRAKP1, payloadRAKP2, rakp1)
+	if err != nil {
+		return fmt.Errorf("RAKP 2: %w", err)
+	}
+	if len(resp) < 40 {
+		return fmt.Errorf("RAKP 2: %s", errShortPacket)
+	}
+	rc := append([]byte(nil), resp[8:24]...)
+	guid := append([]byte(nil), resp[24:40]...)
+
+	kuid := make([]byte, maxPasswordLength)
+	copy(kuid, c.Password)
+	var authHash = suite.authHash()
+	if suite.auth == authNone {
+		authHash = nil
+	}
+	expected := hmacSum(authHash, kuid, consoleID, managedID, rm, rc, guid, roleName)
+	if !hmac.Equal(resp[40:], expected) {
+		return ErrAuthentication
+	}
+	sik := hmacSum(authHash, kuid, rm, rc, roleName)
+	c.keys = deriveKeys(suite, sik)
+
+	rakp3 := []byte{tag, 0, 0, 0}
+	rakp3 = append(rakp3, managedID...)
+	rakp3 = append(rakp3, hmacSum(authHash, kuid, rc, consoleID, roleName)...)
+	resp, err = c.sessionSetup(ctx, payloadRAKP3, payloadRAKP4, rakp3)
+	if err != nil {
+		return fmt.Errorf("RAKP 4: %w", err)
+	}
+	if icv := suite.icvLen(); icv > 0 {
+		expected = hmacSum(authHash, sik, rm, managedID, guid)[:icv]
+		if len(resp) < 8+icv || !hmac.Equal(resp[8:8+icv], expected) {
+			return errors.New("RAKP 4: integrity check value mismatch")
+		}
+	}
+
+	c.active = true
+	if _, err := c.execute(ctx, NetFnApp, 0, cmdSetSessionPrivilege, []byte{uint8(c.Privilege)}); err != nil {
+		return fmt.Errorf("set session privilege level: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) channelAuthCapabilities(ctx context.Context) error {
+	msg := ipmiMessage(NetFnApp, 0, cmdGetChannelAuthCaps, 0,
+		[]byte{channelAuthCapsExtended | channelCurrent, uint8(c.Privilege)})
+	var resp *response
+	err := c.roundTrip(ctx, func() ([]byte, error) {
+		return v15Packet(msg), nil
+	}, func(h *v20Header) bool {
+		r, err := parseIPMIResponse(h.payload)
+		if err != nil || r.cmd != cmdGetChannelAuthCaps {
+			return false
+		}
+		resp = r
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if resp.code != 0 {
+		return CompletionCode(resp.code)
+	}
+	if len(resp.data) < 4 || resp.data[1]&channelAuthCapsExtended == 0 || resp.data[3]&channelAuthCapsIPMI20Bit == 0 {
+		return errors.New("BMC does not support IPMI 2.0")
+	}
+	return nil
+}
+
+// sessionSetup sends one of the session-less open session or RAKP payloads
+// and returns the matching response after checking its status code.
+func (c *Client) sessionSetup(ctx context.Context, reqType, respType uint8, payload []byte) ([]byte, error) {
+	pkt := rmcpHeader()
+	pkt = append(pkt, authTypeRMCPPlus, reqType, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint16(pkt[14:16], uint16(len(payload)))
+	pkt = append(pkt, payload...)
+
+	var resp []byte
+	err := c.roundTrip(ctx, func() ([]byte, error) {
+		return pkt, nil
+	}, func(h *v20Header) bool {
+		if h.payloadType&payloadTypeMask != respType || len(h.payload) < 2 || h.payload[0] != payload[0] {
+			return false
+		}
+		resp = append([]byte(nil), h.payload...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[1] != 0 {
+		return nil, StatusCode(resp[1])
+	}
+	return resp, nil
+}
+
+func (c *Client) sessionPacket(payload []byte) ([]byte, error) {
+	c.sequence++
+	body, err := c.keys.encrypt(payload)
+	if err != nil {
+		return nil, err
+	}
+	payloadType := uint8(payloadIPMI)
+	if c.keys.suite.confidentiality != confidentialityNone {
+		payloadType |= payloadEncrypted
+	}
+	if c.keys.suite.integrity != integrityNone {
+		payloadType |= payloadAuthenticated
+	}
+	pkt := make([]byte, 12, 12+len(body)+32)
+	pkt[0] = authTypeRMCPPlus
+	pkt[1] = payloadType
+	binary.LittleEndian.PutUint32(pkt[2:6], c.managedID)
+	binary.LittleEndian.PutUint32(pkt[6:10], c.sequence)
+	binary.LittleEndian.PutUint16(pkt[10:12], uint16(len(body)))
+	pkt = append(pkt, body...)
+	if payloadType&payloadAuthenticated != 0 {
+		pad := (4 - (len(pkt)+2)%4) % 4
+		for i := 0; i < pad; i++ {
+			pkt = append(pkt, 0xff)
+		}
+		pkt = append(pkt, uint8(pad), integrityNextHeader)
+		pkt = append(pkt, c.keys.integrity(pkt)...)
+	}
+	return append(rmcpHeader(), pkt...), nil
+}
+
+func (c *Client) execute(ctx context.Context, netFn, lun, cmd uint8, data []byte) ([]byte, error) {
+	c.rqSeq = (c.rqSeq + 1) & 0x3f
+	seq := c.rqSeq
+	msg := ipmiMessage(netFn, lun, cmd, seq, data)
+	var resp *response
+	err := c.roundTrip(ctx, func() ([]byte, error) {
+		return c.sessionPacket(msg)
+	}, func(h *v20Header) bool {
+		if h.payloadType&payloadTypeMask != payloadIPMI || h.sessionID != c.consoleID {
+			return false
+		}
+		if c.keys.suite.integrity != integrityNone && h.payloadType&payloadAuthenticated != 0 &&
+			!hmac.Equal(h.authCode, c.keys.integrity(h.authenticated)) {
+			return false
+		}
+		payload := h.payload
+		if h.payloadType&payloadEncrypted != 0 {
+			var err error
+			if payload, err = c.keys.decrypt(payload); err != nil {
+				return false
+			}
+		}
+		r, err := parseIPMIResponse(payload)
+		if err != nil || r.seq != seq || r.cmd != cmd || r.netFn != netFn|1 {
+			return false
+		}
+		resp = r
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.code != 0 {
+		return nil, CompletionCode(resp.code)
+	}
+	return append([]byte(nil), resp.data...), nil
+}
+
+// roundTrip writes the packet produced by build and waits for a packet
+// accepted by accept, retransmitting on timeout.
+func (c *Client) roundTrip(ctx context.Context, build func() ([]byte, error), accept func(*v20Header) bool) error {
+	buf := make([]byte, 1024)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if err := contextErr(ctx); err != nil {
+			return err
+		}
+		pkt, err := build()
+		if err != nil {
+			return err
+		}
+		if _, err := c.conn.Write(pkt); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(c.Timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		c.conn.SetReadDeadline(deadline)
+		for {
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return err
+			}
+			h, err := parsePacket(buf[:n])
+			if err != nil {
+				continue
+			}
+			if accept(h) {
+				return nil
+			}
+		}
+	}
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	return ErrTimeout
+}
+
+// contextErr is ctx.Err, except that it already reports a passed deadline
+// when the read deadline derived from it fires just before the context's own
+// timer.
+func contextErr(ctx context.Context) error {
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,502 @@
+package ipmi
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testUser     = "admin"
+	testPassword = "secret"
+
+	// testSensorNumber is the number of the full sensor record served by
+	// fakeBMC.
+	testSensorNumber = 0x05
+)
+
+// fakeBMC answers RMCP+ requests on a local UDP socket: the RAKP handshake
+// and the handful of commands the client implements.
+type fakeBMC struct {
+	t        *testing.T
+	conn     *net.UDPConn
+	user     string
+	password string
+	suite    cipherSuite
+
+	mu        sync.Mutex
+	consoleID []byte
+	managedID []byte
+	rm, rc    []byte
+	guid      []byte
+	role      []byte
+	keys      *keys
+	sequence  uint32
+	sdrs      [][]byte
+	// cancelReservations is the number of Get SDR requests to fail with
+	// reservation canceled, drop the number of session packets to ignore.
+	cancelReservations int
+	drop               int
+	dropped            int
+}
+
+func newFakeBMC(t *testing.T, suite int) *fakeBMC {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBMC{
+		t:         t,
+		conn:      conn,
+		user:      testUser,
+		password:  testPassword,
+		suite:     cipherSuites[suite],
+		managedID: []byte{0x11, 0x22, 0x33, 0x44},
+		rc:        make([]byte, 16),
+		guid:      make([]byte, 16),
+		sdrs:      [][]byte{fullSDR(), compactSDR()},
+	}
+	for i := range b.rc {
+		b.rc[i] = byte(i * 7)
+		b.guid[i] = byte(i * 3)
+	}
+	go b.serve()
+	return b
+}
+
+// fullSDR returns a temperature sensor with the conversion
+// y = (2x - 5 * 10^1) * 10^-1.
+func fullSDR() []byte {
+	rec := make([]byte, 48)
+	rec[1], rec[2], rec[3] = 0x00, 0x51, sdrTypeFullSensor
+	rec[5], rec[7] = bmcSlaveAddr, testSensorNumber
+	rec[12], rec[13] = 0x01, EventReadingTypeThreshold
+	rec[20], rec[21] = 0x00, 0x01
+	rec[24] = 2
+	rec[26], rec[27] = 0xfb, 0xc0
+	rec[29] = 0xf1
+	name := "01-CPU Temp"
+	rec[47] = 0xc0 | byte(len(name))
+	rec = append(rec, name...)
+	rec[4] = byte(len(rec) - sdrHeaderLength)
+	return rec
+}
+
+// compactSDR returns a discrete power supply sensor.
+func compactSDR() []byte {
+	rec := make([]byte, 32)
+	rec[0], rec[2], rec[3] = 0x01, 0x51, sdrTypeCompactSensor
+	rec[5], rec[7] = bmcSlaveAddr, 0x06
+	rec[12], rec[13] = 0x08, 0x6f
+	name := "PSU 1"
+	rec[31] = 0xc0 | byte(len(name))
+	rec = append(rec, name...)
+	rec[4] = byte(len(rec) - sdrHeaderLength)
+	return rec
+}
+
+func (b *fakeBMC) addr() string {
+	return b.conn.LocalAddr().String()
+}
+
+func (b *fakeBMC) close() {
+	b.conn.Close()
+}
+
+func (b *fakeBMC) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if resp := b.handle(buf[:n]); resp != nil {
+			b.conn.WriteToUDP(resp, from)
+		}
+	}
+}
+
+func (b *fakeBMC) handle(pkt []byte) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h, err := parsePacket(pkt)
+	if err != nil {
+		b.t.Errorf("fake BMC: %s", err)
+		return nil
+	}
+	kuid := make([]byte, maxPasswordLength)
+	copy(kuid, b.password)
+	authHash := b.suite.authHash()
+	p := h.payload
+	switch h.payloadType & payloadTypeMask {
+	case payloadOpenSessionReq:
+		b.consoleID = append([]byte(nil), p[4:8]...)
+		resp := []byte{p[0], 0, p[1], 0}
+		resp = append(resp, b.consoleID...)
+		resp = append(resp, b.managedID...)
+		resp = append(resp, p[8:32]...)
+		return sessionless(payloadOpenSessionResp, resp)
+	case payloadRAKP1:
+		b.rm = append([]byte(nil), p[8:24]...)
+		n := int(p[27])
+		b.role = append([]byte{p[24], p[27]}, p[28:28+n]...)
+		resp := []byte{p[0], 0, 0, 0}
+		if string(p[28:28+n]) != b.user {
+			resp[1] = 0x0d
+			return sessionless(payloadRAKP2, resp)
+		}
+		resp = append(resp, b.consoleID...)
+		resp = append(resp, b.rc...)
+		resp = append(resp, b.guid...)
+		resp = append(resp, hmacSum(authHash, kuid, b.consoleID, b.managedID, b.rm, b.rc, b.guid, b.role)...)
+		return sessionless(payloadRAKP2, resp)
+	case payloadRAKP3:
+		resp := []byte{p[0], 0, 0, 0}
+		if !hmac.Equal(p[8:], hmacSum(authHash, kuid, b.rc, b.consoleID, b.role)) {
+			resp[1] = 0x0f
+			return sessionless(payloadRAKP4, resp)
+		}
+		sik := hmacSum(authHash, kuid, b.rm, b.rc, b.role)
+		b.keys = deriveKeys(b.suite, sik)
+		resp = append(resp, b.consoleID...)
+		resp = append(resp, hmacSum(authHash, sik, b.rm, b.managedID, b.guid)[:b.suite.icvLen()]...)
+		return sessionless(payloadRAKP4, resp)
+	case payloadIPMI:
+		if h.sessionID == 0 {
+			return v15Packet(b.respond(p))
+		}
+		if b.drop > 0 {
+			b.drop--
+			b.dropped++
+			return nil
+		}
+		if h.payloadType&payloadAuthenticated != 0 && !hmac.Equal(h.authCode, b.keys.integrity(h.authenticated)) {
+			b.t.Errorf("fake BMC: integrity check failed")
+			return nil
+		}
+		if h.payloadType&payloadEncrypted != 0 {
+			if p, err = b.keys.decrypt(p); err != nil {
+				b.t.Errorf("fake BMC: %s", err)
+				return nil
+			}
+		}
+		return b.sessionPacket(b.respond(p))
+	}
+	b.t.Errorf("fake BMC: unexpected payload type 0x%02x", h.payloadType)
+	return nil
+}
+
+func sessionless(payloadType uint8, payload []byte) []byte {
+	pkt := rmcpHeader()
+	pkt = append(pkt, authTypeRMCPPlus, payloadType, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint16(pkt[14:16], uint16(len(payload)))
+	return append(pkt, payload...)
+}
+
+func (b *fakeBMC) sessionPacket(payload []byte) []byte {
+	b.sequence++
+	body, err := b.keys.encrypt(payload)
+	if err != nil {
+		b.t.Errorf("fake BMC: %s", err)
+		return nil
+	}
+	payloadType := uint8(payloadIPMI)
+	if b.suite.confidentiality != confidentialityNone {
+		payloadType |= payloadEncrypted
+	}
+	if b.suite.integrity != integrityNone {
+		payloadType |= payloadAuthenticated
+	}
+	pkt := []byte{authTypeRMCPPlus, payloadType}
+	pkt = append(pkt, b.consoleID...)
+	pkt = append(pkt, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(pkt[6:10], b.sequence)
+	binary.LittleEndian.PutUint16(pkt[10:12], uint16(len(body)))
+	pkt = append(pkt, body...)
+	if payloadType&payloadAuthenticated != 0 {
+		pad := (4 - (len(pkt)+2)%4) % 4
+		for i := 0; i < pad; i++ {
+			pkt = append(pkt, 0xff)
+		}
+		pkt = append(pkt, uint8(pad), integrityNextHeader)
+		pkt = append(pkt, b.keys.integrity(pkt)...)
+	}
+	return append(rmcpHeader(), pkt...)
+}
+
+// respond executes the request message msg and returns the response message.
+func (b *fakeBMC) respond(msg []byte) []byte {
+	netFn, seq, cmd := msg[1]>>2, msg[4]>>2, msg[5]
+	code, data := b.command(netFn, cmd, msg[6:len(msg)-1])
+	resp := []byte{remoteSWID, (netFn | 1) << 2, 0}
+	resp[2] = checksum(resp[:2])
+	resp = append(resp, bmcSlaveAddr, seq<<2, cmd, code)
+	resp = append(resp, data...)
+	return append(resp, checksum(resp[3:]))
+}
+
+func (b *fakeBMC) command(netFn, cmd uint8, data []byte) (uint8, []byte) {
+	switch {
+	case netFn == NetFnApp && cmd == cmdGetChannelAuthCaps:
+		return 0, []byte{0x01, channelAuthCapsExtended | 0x04, 0x14, channelAuthCapsIPMI20Bit, 0, 0, 0, 0}
+	case netFn == NetFnApp && cmd == cmdSetSessionPrivilege:
+		return 0, []byte{data[0]}
+	case netFn == NetFnApp && cmd == cmdCloseSession:
+		return 0, nil
+	case netFn == NetFnApp && cmd == cmdGetDeviceID:
+		return 0, []byte{0x22, 0x01, 0x81, 0x12, 0x02, 0xbf, 0xc5, 0x28, 0x00, 0x04, 0x00}
+	case netFn == NetFnChassis && cmd == cmdGetChassisStatus:
+		// Powered on with an always-on restore policy, last power event
+		// an AC failure, drive fault and identify on.
+		return 0, []byte{0x41, 0x01, 0x64}
+	case netFn == NetFnGroupExtension && cmd == cmdDCMIPowerReading:
+		return 0, []byte{
+			dcmiGroupExtensionID,
+			0x58, 0x00, 0x50, 0x00, 0x7e, 0x00, 0x5a, 0x00,
+			0x00, 0xe1, 0xf5, 0x05,
+			0xe0, 0x93, 0x04, 0x00,
+			0x40,
+		}
+	case netFn == NetFnStorage && cmd == cmdReserveSDRRepository:
+		return 0, []byte{0x01, 0x00}
+	case netFn == NetFnStorage && cmd == cmdGetSDR:
+		if b.cancelReservations > 0 {
+			b.cancelReservations--
+			return uint8(CompletionReservationCanceled), nil
+		}
+		id := int(binary.LittleEndian.Uint16(data[2:4]))
+		if id >= len(b.sdrs) {
+			return 0xcb, nil
+		}
+		rec := b.sdrs[id]
+		next := uint16(id + 1)
+		if int(next) == len(b.sdrs) {
+			next = sdrLastRecordID
+		}
+		offset, count := int(data[4]), int(data[5])
+		if offset+count > len(rec) {
+			count = len(rec) - offset
+		}
+		resp := []byte{byte(next), byte(next >> 8)}
+		return 0, append(resp, rec[offset:offset+count]...)
+	case netFn == NetFnSensorEvent && cmd == cmdGetSensorReading:
+		if data[0] == testSensorNumber {
+			return 0, []byte{150, 0xc0, AboveUpperNonCritical}
+		}
+		return 0, []byte{0, 0xc0, 0x01, 0x00}
+	case netFn == NetFnSensorEvent && cmd == cmdGetSensorThresholds:
+		// Only lower and upper critical are readable.
+		return 0, []byte{0x12, 0, 50, 0, 0, 200, 0}
+	}
+	return uint8(CompletionInvalidCommand), nil
+}
+
+// openClient returns a client with an open session to b.
+func openClient(t *testing.T, b *fakeBMC, suite int) *Client {
+	c := NewClient(b.addr(), testUser, testPassword)
+	c.CipherSuite = suite
+	c.Timeout = 200 * time.Millisecond
+	if err := c.Open(context.Background()); err != nil {
+		t.Fatalf("open session with cipher suite %d: %s", suite, err)
+	}
+	return c
+}
+
+func TestOpen(t *testing.T) {
+	for _, suite := range []int{1, 2, 3, 17} {
+		b := newFakeBMC(t, suite)
+		c := openClient(t, b, suite)
+		if !c.Active() {
+			t.Errorf("suite %d: session not active after open", suite)
+		}
+		id, err := c.GetDeviceID(context.Background())
+		if err != nil {
+			t.Errorf("suite %d: get device ID: %s", suite, err)
+		} else if id.ManufacturerID != 10437 || id.FirmwareMajor != 1 || id.FirmwareMinor != 0x12 || id.IPMIVersionMajor != 2 {
+			t.Errorf("suite %d: unexpected device ID %+v", suite, id)
+		}
+		if err := c.Close(); err != nil {
+			t.Errorf("suite %d: close: %s", suite, err)
+		}
+		if c.Active() {
+			t.Errorf("suite %d: session active after close", suite)
+		}
+		b.close()
+	}
+}
+
+func TestOpenWrongPassword(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	c := NewClient(b.addr(), testUser, "wrong")
+	c.Timeout = 200 * time.Millisecond
+	if err := c.Open(context.Background()); err != ErrAuthentication {
+		t.Fatalf("expected %q, got %v", ErrAuthentication, err)
+	}
+	if c.Active() {
+		t.Error("session active after failed authentication")
+	}
+}
+
+func TestOpenUnknownUser(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	c := NewClient(b.addr(), "nobody", testPassword)
+	c.Timeout = 200 * time.Millisecond
+	var status StatusCode
+	if err := c.Open(context.Background()); !errors.As(err, &status) || status != 0x0d {
+		t.Fatalf("expected unauthorized name status, got %v", err)
+	}
+}
+
+func TestGetSDRRepository(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	b.mu.Lock()
+	b.cancelReservations = 1
+	b.mu.Unlock()
+	c := openClient(t, b, 3)
+	defer c.Close()
+	sdrs, err := c.GetSDRRepository(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdrs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(sdrs))
+	}
+	temp, psu := sdrs[0], sdrs[1]
+	if temp.Name != "01-CPU Temp" || temp.SensorNumber != testSensorNumber || !temp.Analog() ||
+		temp.TypeName() != "Temperature" || temp.Unit() != "C" {
+		t.Errorf("unexpected full record %+v", temp)
+	}
+	if psu.Name != "PSU 1" || psu.Analog() || psu.TypeName() != "Power Supply" || psu.Unit() != "N/A" {
+		t.Errorf("unexpected compact record %+v", psu)
+	}
+}
+
+func TestGetSensorReading(t *testing.T) {
+	b := newFakeBMC(t, 17)
+	defer b.close()
+	c := openClient(t, b, 17)
+	defer c.Close()
+	ctx := context.Background()
+	sdrs, err := c.GetSDRRepository(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.GetSensorReading(ctx, sdrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Raw != 150 || r.Unavailable || r.State != AboveUpperNonCritical {
+		t.Errorf("unexpected reading %+v", r)
+	}
+	if v := sdrs[0].Convert(r.Raw); math.Abs(v-25) > 1e-9 {
+		t.Errorf("expected raw reading 150 to convert to 25, got %v", v)
+	}
+	th, err := c.GetSensorThresholds(ctx, sdrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(th.LowerCritical-5) > 1e-9 || math.Abs(th.UpperCritical-35) > 1e-9 {
+		t.Errorf("unexpected critical thresholds %+v", th)
+	}
+	if !math.IsNaN(th.LowerNonCritical) || !math.IsNaN(th.UpperNonRecoverable) {
+		t.Errorf("expected unreadable thresholds to be NaN, got %+v", th)
+	}
+}
+
+func TestGetChassisStatus(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	c := openClient(t, b, 3)
+	defer c.Close()
+	cs, err := c.GetChassisStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ChassisStatus{
+		PowerOn:           true,
+		RestorePolicy:     2,
+		LastPowerEvent:    1,
+		DriveFault:        true,
+		IdentifyState:     2,
+		IdentifySupported: true,
+	}
+	if *cs != expected {
+		t.Errorf("expected %+v, got %+v", expected, *cs)
+	}
+}
+
+func TestGetPowerReading(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	c := openClient(t, b, 3)
+	defer c.Close()
+	pr, err := c.GetPowerReading(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PowerReading{
+		Current:   88,
+		Minimum:   80,
+		Maximum:   126,
+		Average:   90,
+		Timestamp: time.Unix(100000000, 0),
+		Period:    300 * time.Second,
+		Active:    true,
+	}
+	if *pr != expected {
+		t.Errorf("expected %+v, got %+v", expected, *pr)
+	}
+}
+
+func TestRetransmit(t *testing.T) {
+	b := newFakeBMC(t, 3)
+	defer b.close()
+	c := openClient(t, b, 3)
+	defer c.Close()
+	c.Timeout = 50 * time.Millisecond
+	b.mu.Lock()
+	b.drop = c.Retries
+	b.mu.Unlock()
+	if _, err := c.GetDeviceID(context.Background()); err != nil {
+		t.Fatalf("expected the last retransmission to succeed, got %s", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped != c.Retries {
+		t.Errorf("expected %d dropped requests, got %d", c.Retries, b.dropped)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewClient(conn.LocalAddr().String(), testUser, testPassword)
+	c.Timeout = 50 * time.Millisecond
+	c.Retries = 1
+	start := time.Now()
+	err = c.Open(context.Background())
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected %q, got %v", ErrTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*c.Timeout || elapsed > time.Second {
+		t.Errorf("expected two attempts of %s, took %s", c.Timeout, elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Open(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context deadline to win, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	cmdGetDeviceID       = 0x01
+	cmdGetSystemGUID     = 0x37
+	cmdGetChannelInfo    = 0x42
+	cmdGetChassisStatus  = 0x01
+	cmdDCMIPowerReading  = 0x02
+	dcmiGroupExtensionID = 0xdc
+	dcmiSystemPowerStats = 0x01
+)
+
+// DeviceID is the response to the Get Device ID command.
+type DeviceID struct {
+	DeviceID       uint8
+	DeviceRevision uint8
+	FirmwareMajor  uint8
+	// FirmwareMinor is BCD encoded per the specification, though some
+	// vendors put arbitrary values in it.
+	FirmwareMinor    uint8
+	IPMIVersionMajor uint8
+	IPMIVersionMinor uint8
+	ManufacturerID   uint32
+	ProductID        uint16
+}
+
+// GetDeviceID issues the Get Device ID command. It is cheap enough to double
+// as a session keepalive.
+func (c *Client) GetDeviceID(ctx context.Context) (*DeviceID, error) {
+	data, err := c.Execute(ctx, NetFnApp, cmdGetDeviceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 11 {
+		return nil, errShortPacket
+	}
+	return &DeviceID{
+		DeviceID:         data[0],
+		DeviceRevision:   data[1] & 0x0f,
+		FirmwareMajor:    data[2] & 0x7f,
+		FirmwareMinor:    data[3],
+		IPMIVersionMajor: data[4] & 0x0f,
+		IPMIVersionMinor: data[4] >> 4,
+		ManufacturerID:   uint32(data[6]) | uint32(data[7])<<8 | uint32(data[8]&0x0f)<<16,
+		ProductID:        binary.LittleEndian.Uint16(data[9:11]),
+	}, nil
+}
+
+// GetSystemGUID returns the BMC's GUID in the byte order it was sent, least
+// significant byte first.
+func (c *Client) GetSystemGUID(ctx context.Context) ([]byte, error) {
+	data, err := c.Execute(ctx, NetFnApp, cmdGetSystemGUID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 {
+		return nil, errShortPacket
+	}
+	return data[:16], nil
+}
+
+// ChannelInfo is the response to Get Channel Info.
+type ChannelInfo struct {
+	Number         uint8
+	MediumType     uint8
+	ProtocolType   uint8
+	SessionSupport uint8
+	ActiveSessions uint8
+	VendorID       uint32
+}
+
+// GetChannelInfo issues the Get Channel Info command for the given channel.
+func (c *Client) GetChannelInfo(ctx context.Context, channel uint8) (*ChannelInfo, error) {
+	data, err := c.Execute(ctx, NetFnApp, cmdGetChannelInfo, []byte{channel & 0x0f})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 7 {
+		return nil, errShortPacket
+	}
+	return &ChannelInfo{
+		Number:         data[0] & 0x0f,
+		MediumType:     data[1] & 0x7f,
+		ProtocolType:   data[2] & 0x1f,
+		SessionSupport: data[3] >> 6,
+		ActiveSessions: data[3] & 0x3f,
+		VendorID:       uint32(data[4]) | uint32(data[5])<<8 | uint32(data[6])<<16,
+	}, nil
+}
+
+// Power restore policies reported in the chassis status.
+const (
+	RestorePolicyAlwaysOff = 0x00
+	RestorePolicyPrevious  = 0x01
+	RestorePolicyAlwaysOn  = 0x02
+	RestorePolicyUnknown   = 0x03
+)
+
+// Chassis identify states reported in the chassis status.
+const (
+	IdentifyOff          = 0x00
+	IdentifyTimedOn      = 0x01
+	IdentifyIndefiniteOn = 0x02
+)
+
+// Causes of the last power event, as bits of ChassisStatus.LastPowerEvent.
+const (
+	PowerEventACFailed    = 0x01
+	PowerEventOverload    = 0x02
+	PowerEventInterlock   = 0x04
+	PowerEventFault       = 0x08
+	PowerEventIPMICommand = 0x10
+)
+
+// ChassisStatus is the decoded response to Get Chassis Status.
+type ChassisStatus struct {
+	PowerOn           bool
+	PowerOverload     bool
+	Interlock         bool
+	PowerFault        bool
+	PowerControlFault bool
+	RestorePolicy     uint8
+	LastPowerEvent    uint8
+	Intrusion         bool
+	FrontPanelLockout bool
+	DriveFault        bool
+	CoolingFault      bool
+	IdentifyState     uint8
+	IdentifySupported bool
+}
+
+// GetChassisStatus issues the Get Chassis Status command.
+func (c *Client) GetChassisStatus(ctx context.Context) (*ChassisStatus, error) {
+	data, err := c.Execute(ctx, NetFnChassis, cmdGetChassisStatus, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 3 {
+		return nil, errShortPacket
+	}
+	return &ChassisStatus{
+		PowerOn:           data[0]&0x01 != 0,
+		PowerOverload:     data[0]&0x02 != 0,
+		Interlock:         data[0]&0x04 != 0,
+		PowerFault:        data[0]&0x08 != 0,
+		PowerControlFault: data[0]&0x10 != 0,
+		RestorePolicy:     data[0] >> 5 & 0x03,
+		LastPowerEvent:    data[1] & 0x1f,
+		Intrusion:         data[2]&0x01 != 0,
+		FrontPanelLockout: data[2]&0x02 != 0,
+		DriveFault:        data[2]&0x04 != 0,
+		CoolingFault:      data[2]&0x08 != 0,
+		IdentifyState:     data[2] >> 4 & 0x03,
+		IdentifySupported: data[2]&0x40 != 0,
+	}, nil
+}
+
+// PowerReading is the DCMI system power statistics reading.
+type PowerReading struct {
+	Current   uint16
+	Minimum   uint16
+	Maximum   uint16
+	Average   uint16
+	Timestamp time.Time
+	Period    time.Duration
+	Active    bool
+}
+
+// GetPowerReading issues the DCMI Get Power Reading command in system power
+// statistics mode.
+func (c *Client) GetPowerReading(ctx context.Context) (*PowerReading, error) {
+	data, err := c.Execute(ctx, NetFnGroupExtension, cmdDCMIPowerReading,
+		[]byte{dcmiGroupExtensionID, dcmiSystemPowerStats, 0x00, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 18 {
+		return nil, errShortPacket
+	}
+	if data[0] != dcmiGroupExtensionID {
+		return nil, errors.New("unexpected DCMI group extension ID")
+	}
+	return &PowerReading{
+		Current:   binary.LittleEndian.Uint16(data[1:3]),
+		Minimum:   binary.LittleEndian.Uint16(data[3:5]),
+		Maximum:   binary.LittleEndian.Uint16(data[5:7]),
+		Average:   binary.LittleEndian.Uint16(data[7:9]),
+		Timestamp: time.Unix(int64(binary.LittleEndian.Uint32(data[9:13])), 0),
+		Period:    time.Duration(binary.LittleEndian.Uint32(data[13:17])) * time.Millisecond,
+		Active:    data[17]&0x40 != 0,
+	}, nil
+}
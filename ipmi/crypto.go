@@ -0,0 +1,167 @@
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+const (
+	authNone       = 0x00
+	authHMACSHA1   = 0x01
+	authHMACSHA256 = 0x03
+
+	integrityNone          = 0x00
+	integrityHMACSHA1_96   = 0x01
+	integrityHMACSHA256128 = 0x04
+
+	confidentialityNone      = 0x00
+	confidentialityAESCBC128 = 0x01
+
+	// keyConstantLength is the length of the constants K1 and K2 are derived
+	// from. It stays 20 bytes with HMAC-SHA256, like in ipmitool and FreeIPMI.
+	keyConstantLength = 20
+)
+
+// randRead supplies session IDs, random numbers and IVs. Tests replace it to
+// replay a known exchange.
+var randRead = rand.Read
+
+type cipherSuite struct {
+	auth            uint8
+	integrity       uint8
+	confidentiality uint8
+}
+
+// Cipher suites from table 22-19 of the IPMI 2.0 specification that this
+// client implements.
+var cipherSuites = map[int]cipherSuite{
+	0:  {authNone, integrityNone, confidentialityNone},
+	1:  {authHMACSHA1, integrityNone, confidentialityNone},
+	2:  {authHMACSHA1, integrityHMACSHA1_96, confidentialityNone},
+	3:  {authHMACSHA1, integrityHMACSHA1_96, confidentialityAESCBC128},
+	17: {authHMACSHA256, integrityHMACSHA256128, confidentialityAESCBC128},
+}
+
+func (s cipherSuite) authHash() func() hash.Hash {
+	if s.auth == authHMACSHA256 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+func (s cipherSuite) integrityHash() func() hash.Hash {
+	if s.integrity == integrityHMACSHA256128 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+// icvLen returns the length of the RAKP 4 integrity check value.
+func (s cipherSuite) icvLen() int {
+	switch s.auth {
+	case authHMACSHA1:
+		return 12
+	case authHMACSHA256:
+		return 16
+	}
+	return 0
+}
+
+func (s cipherSuite) integrityLen() int {
+	switch s.integrity {
+	case integrityHMACSHA1_96:
+		return 12
+	case integrityHMACSHA256128:
+		return 16
+	}
+	return 0
+}
+
+func hmacSum(h func() hash.Hash, key []byte, parts ...[]byte) []byte {
+	if h == nil {
+		return nil
+	}
+	mac := hmac.New(h, key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// keys holds the session keys derived from the RAKP exchange.
+type keys struct {
+	suite cipherSuite
+	sik   []byte
+	k1    []byte
+	k2    []byte
+}
+
+func deriveKeys(suite cipherSuite, sik []byte) *keys {
+	k := &keys{suite: suite, sik: sik}
+	if suite.auth == authNone {
+		return k
+	}
+	h := suite.authHash()
+	k.k1 = hmacSum(h, sik, bytes.Repeat([]byte{0x01}, keyConstantLength))
+	k.k2 = hmacSum(h, sik, bytes.Repeat([]byte{0x02}, keyConstantLength))
+	return k
+}
+
+func (k *keys) integrity(data []byte) []byte {
+	if k.suite.integrity == integrityNone {
+		return nil
+	}
+	return hmacSum(k.suite.integrityHash(), k.k1, data)[:k.suite.integrityLen()]
+}
+
+func (k *keys) encrypt(payload []byte) ([]byte, error) {
+	if k.suite.confidentiality == confidentialityNone {
+		return payload, nil
+	}
+	block, err := aes.NewCipher(k.k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	padLen := (aes.BlockSize - (len(payload)+1)%aes.BlockSize) % aes.BlockSize
+	plain := make([]byte, 0, len(payload)+padLen+1)
+	plain = append(plain, payload...)
+	for i := 1; i <= padLen; i++ {
+		plain = append(plain, uint8(i))
+	}
+	plain = append(plain, uint8(padLen))
+
+	out := make([]byte, aes.BlockSize+len(plain))
+	if _, err := randRead(out[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], plain)
+	return out, nil
+}
+
+func (k *keys) decrypt(payload []byte) ([]byte, error) {
+	if k.suite.confidentiality == confidentialityNone {
+		return payload, nil
+	}
+	if len(payload) < 2*aes.BlockSize || len(payload)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted payload length %d", len(payload))
+	}
+	block, err := aes.NewCipher(k.k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(payload)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, payload[:aes.BlockSize]).CryptBlocks(plain, payload[aes.BlockSize:])
+	padLen := int(plain[len(plain)-1])
+	if padLen >= aes.BlockSize || padLen+1 > len(plain) {
+		return nil, errors.New("invalid confidentiality pad")
+	}
+	return plain[:len(plain)-padLen-1], nil
+}
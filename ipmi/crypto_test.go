@@ -0,0 +1,158 @@
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+// knownExchanges are session setups computed independently of this package
+// from the formulas in sections 13.28 to 13.32 of the IPMI 2.0
+// specification, for user admin with password secret at user privilege. The
+// console uses session ID a0a1a2a3h, Rm 10h..1fh and IV 20h..2fh, the BMC
+// session ID b0b1b2b3h, Rc 30h..3fh, GUID 40h..4fh and IV 50h..5fh. The last
+// request and response are the encrypted Set Session Privilege Level.
+var knownExchanges = []struct {
+	suite     int
+	sik       string
+	k1, k2    string
+	requests  []string
+	responses []string
+}{
+	{
+		suite: 3,
+		sik:   "c3f05ee7641eaf5a974fb4a7a7882a8382e9ba73",
+		k1:    "2b95bf1a5f9673f9100c3cee4af86563e1277611",
+		k2:    "cb47caa01704fd29f5f59a7bf7b9a6b88759519b",
+		requests: []string{
+			"0600ff0706100000000000000000200000020000a0a1a2a3000000080100000001000008010000000200000801000000",
+			"0600ff0706120000000000000000210000000000b0b1b2b3101112131415161718191a1b1c1d1e1f0200000561646d696e",
+			"0600ff07061400000000000000001c0000000000b0b1b2b382b7e34a9ee091f28ef3032ec41876894d771721",
+			"0600ff0706c0b0b1b2b3010000002000202122232425262728292a2b2c2d2e2f45d622d52ef683f4a724169eccc008dfffff0207b858daa70ff3d36f49986e21",
+		},
+		responses: []string{
+			"0600ff0706110000000000000000240000000200a0a1a2a3b0b1b2b3000000080100000001000008010000000200000801000000",
+			"0600ff07061300000000000000003c0000000000a0a1a2a3303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4fa7f03ec85ff8c25a4a352e2a8b93756f2a649571",
+			"0600ff0706150000000000000000140000000000a0a1a2a3ddb43389adfc697d2a70661d",
+			"0600ff0706c0a0a1a2a3010000002000505152535455565758595a5b5c5d5e5fb8b7ed8f541bea732632796d61f52e04ffff0207d3731ee7e0d05e783cf14c3c",
+		},
+	},
+	{
+		suite: 17,
+		sik:   "d7865e5d2d6feed22dff16ef65ee117127be40876b1504e36e7c5d3a8ce34f27",
+		k1:    "47999d503a5d55d557dc68782b679980bcf6bb6dae7ab6e3194d370237499b5b",
+		k2:    "ea2a009fbba3ef7a2950dd65c3b7dd1520029cfb57a4618bc3bb1789c12a7340",
+		requests: []string{
+			"0600ff0706100000000000000000200000020000a0a1a2a3000000080300000001000008040000000200000801000000",
+			"0600ff0706120000000000000000210000000000b0b1b2b3101112131415161718191a1b1c1d1e1f0200000561646d696e",
+			"0600ff0706140000000000000000280000000000b0b1b2b3a1f21aea78ca2df50d22106e156990a9eb40fe30a9a92fda2f8ba1ee3993e19f",
+			"0600ff0706c0b0b1b2b3010000002000202122232425262728292a2b2c2d2e2f15884242b655421df3ac8faccf926deeffff0207ffc458f92a9a7e6bdea74bed7d44c98d",
+		},
+		responses: []string{
+			"0600ff0706110000000000000000240000000200a0a1a2a3b0b1b2b3000000080300000001000008040000000200000801000000",
+			"0600ff0706130000000000000000480000000000a0a1a2a3303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4fc53ce9475cd7423d6cd21905339b368e21b69675db5f8edfa73ca1df3861ca15",
+			"0600ff0706150000000000000000180000000000a0a1a2a3d18d57e83648f9fe8cc8e87a6daf5690",
+			"0600ff0706c0a0a1a2a3010000002000505152535455565758595a5b5c5d5e5f4f3d002355175c71b43a8244411c90ecffff0207275c08dfb48c288e5f16bd0b15de5160",
+		},
+	},
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sequence returns n consecutive byte values starting at start.
+func sequence(start byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+	return b
+}
+
+// replayRandom makes randRead return chunks in order and returns a function
+// restoring it.
+func replayRandom(t *testing.T, chunks ...[]byte) func() {
+	saved := randRead
+	randRead = func(b []byte) (int, error) {
+		if len(chunks) == 0 || len(chunks[0]) != len(b) {
+			t.Fatalf("unexpected read of %d random bytes", len(b))
+		}
+		n := copy(b, chunks[0])
+		chunks = chunks[1:]
+		return n, nil
+	}
+	return func() { randRead = saved }
+}
+
+// serveExchange answers the pre-session Get Channel Authentication
+// Capabilities request and then expects the requests of the exchange in
+// order, answering each with its response.
+func serveExchange(t *testing.T, conn *net.UDPConn, requests, responses [][]byte) {
+	buf := make([]byte, 1024)
+	for len(requests) > 0 {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		pkt := buf[:n]
+		if h, err := parsePacket(pkt); err == nil && pkt[4] == authTypeNone {
+			conn.WriteToUDP(v15Packet((&fakeBMC{}).respond(h.payload)), from)
+			continue
+		}
+		if !bytes.Equal(pkt, requests[0]) {
+			t.Errorf("unexpected request\n%x\nexpected\n%x", pkt, requests[0])
+			return
+		}
+		conn.WriteToUDP(responses[0], from)
+		requests, responses = requests[1:], responses[1:]
+	}
+}
+
+func TestHandshakeKnownAnswer(t *testing.T) {
+	for _, exchange := range knownExchanges {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var requests, responses [][]byte
+		for i := range exchange.requests {
+			requests = append(requests, unhex(t, exchange.requests[i]))
+			responses = append(responses, unhex(t, exchange.responses[i]))
+		}
+		go serveExchange(t, conn, requests, responses)
+		restore := replayRandom(t, sequence(0xa0, 4), sequence(0x10, 16), sequence(0x20, 16))
+
+		c := NewClient(conn.LocalAddr().String(), testUser, testPassword)
+		c.CipherSuite = exchange.suite
+		c.Timeout = 200 * time.Millisecond
+		c.Retries = 0
+		err = c.Open(context.Background())
+		restore()
+		if err != nil {
+			t.Errorf("suite %d: %s", exchange.suite, err)
+		} else {
+			for _, key := range []struct {
+				name      string
+				got, want []byte
+			}{
+				{"SIK", c.keys.sik, unhex(t, exchange.sik)},
+				{"K1", c.keys.k1, unhex(t, exchange.k1)},
+				{"K2", c.keys.k2, unhex(t, exchange.k2)},
+			} {
+				if !bytes.Equal(key.got, key.want) {
+					t.Errorf("suite %d: expected %s %x, got %x", exchange.suite, key.name, key.want, key.got)
+				}
+			}
+			c.conn.Close()
+		}
+		conn.Close()
+	}
+}
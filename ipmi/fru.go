@@ -0,0 +1,279 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	cmdGetFRUInventoryAreaInfo = 0x10
+	cmdReadFRUData             = 0x11
+
+	sdrTypeFRULocator = 0x11
+
+	fruHeaderLength = 8
+	fruReadChunk    = 16
+	fruEndOfFields  = 0xc1
+)
+
+// fruEpoch is the reference of the board manufacturing date.
+var fruEpoch = time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FRUDevice is a FRU inventory device that can be read through the BMC.
+type FRUDevice struct {
+	ID   uint8
+	Name string
+}
+
+// FRUInventory holds the chassis, board and product info areas of a FRU.
+// Fields that are not present are left empty.
+type FRUInventory struct {
+	ChassisType         string
+	ChassisPartNumber   string
+	ChassisSerialNumber string
+
+	BoardManufactured time.Time
+	BoardManufacturer string
+	BoardProductName  string
+	BoardSerialNumber string
+	BoardPartNumber   string
+
+	ProductManufacturer string
+	ProductName         string
+	ProductPartNumber   string
+	ProductVersion      string
+	ProductSerialNumber string
+	ProductAssetTag     string
+}
+
+// GetFRUDevices returns the default FRU device of the BMC followed by the
+// logical FRU devices announced by FRU device locator records.
+func (c *Client) GetFRUDevices(ctx context.Context) ([]FRUDevice, error) {
+	devices := []FRUDevice{{ID: 0, Name: "Default FRU Device"}}
+	err := c.walkSDR(ctx, func(id uint16, rec []byte) error {
+		if len(rec) < 16 || rec[3] != sdrTypeFRULocator {
+			return nil
+		}
+		logical := rec[7]&0x80 != 0
+		if !logical || rec[5] != bmcSlaveAddr || rec[6] == 0 {
+			return nil
+		}
+		n := int(rec[15] & 0x1f)
+		if 16+n > len(rec) {
+			n = len(rec) - 16
+		}
+		devices = append(devices, FRUDevice{ID: rec[6], Name: string(rec[16 : 16+n])})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// ReadFRU reads and decodes the info areas of a FRU device.
+func (c *Client) ReadFRU(ctx context.Context, id uint8) (*FRUInventory, error) {
+	data, err := c.Execute(ctx, NetFnStorage, cmdGetFRUInventoryAreaInfo, []byte{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 3 {
+		return nil, errShortPacket
+	}
+	size := int(binary.LittleEndian.Uint16(data[0:2]))
+	words := data[2]&0x01 != 0
+
+	header, err := c.readFRU(ctx, id, words, 0, fruHeaderLength)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != 0x01 {
+		return nil, fmt.Errorf("unsupported FRU format version %d", header[0])
+	}
+	area := func(index int) ([]byte, error) {
+		offset := int(header[index]) * 8
+		if offset == 0 || offset+2 > size {
+			return nil, nil
+		}
+		head, err := c.readFRU(ctx, id, words, offset, 2)
+		if err != nil {
+			return nil, err
+		}
+		length := int(head[1]) * 8
+		if length < 2 || offset+length > size {
+			return nil, errors.New("FRU info area exceeds the inventory size")
+		}
+		return c.readFRU(ctx, id, words, offset, length)
+	}
+
+	inv := &FRUInventory{}
+	chassis, err := area(2)
+	if err != nil {
+		return nil, fmt.Errorf("read chassis info area: %w", err)
+	}
+	if len(chassis) > 3 {
+		inv.ChassisType = chassisTypeName(chassis[2])
+		fields := fruFields(chassis[3:])
+		inv.ChassisPartNumber = fieldAt(fields, 0)
+		inv.ChassisSerialNumber = fieldAt(fields, 1)
+	}
+	board, err := area(3)
+	if err != nil {
+		return nil, fmt.Errorf("read board info area: %w", err)
+	}
+	if len(board) > 6 {
+		minutes := uint32(board[3]) | uint32(board[4])<<8 | uint32(board[5])<<16
+		if minutes != 0 {
+			inv.BoardManufactured = fruEpoch.Add(time.Duration(minutes) * time.Minute)
+		}
+		fields := fruFields(board[6:])
+		inv.BoardManufacturer = fieldAt(fields, 0)
+		inv.BoardProductName = fieldAt(fields, 1)
+		inv.BoardSerialNumber = fieldAt(fields, 2)
+		inv.BoardPartNumber = fieldAt(fields, 3)
+	}
+	product, err := area(4)
+	if err != nil {
+		return nil, fmt.Errorf("read product info area: %w", err)
+	}
+	if len(product) > 3 {
+		fields := fruFields(product[3:])
+		inv.ProductManufacturer = fieldAt(fields, 0)
+		inv.ProductName = fieldAt(fields, 1)
+		inv.ProductPartNumber = fieldAt(fields, 2)
+		inv.ProductVersion = fieldAt(fields, 3)
+		inv.ProductSerialNumber = fieldAt(fields, 4)
+		inv.ProductAssetTag = fieldAt(fields, 5)
+	}
+	return inv, nil
+}
+
+// readFRU reads count bytes at offset, honoring word addressed devices.
+func (c *Client) readFRU(ctx context.Context, id uint8, words bool, offset, count int) ([]byte, error) {
+	var out []byte
+	for len(out) < count {
+		n := count - len(out)
+		if n > fruReadChunk {
+			n = fruReadChunk
+		}
+		at, length := offset+len(out), n
+		if words {
+			at, length = at/2, (n+1)/2
+		}
+		req := []byte{id, 0, 0, uint8(length)}
+		binary.LittleEndian.PutUint16(req[1:3], uint16(at))
+		data, err := c.Execute(ctx, NetFnStorage, cmdReadFRUData, req)
+		if err != nil {
+			return nil, fmt.Errorf("read FRU %d at %d: %w", id, offset+len(out), err)
+		}
+		if len(data) < 2 {
+			return nil, errShortPacket
+		}
+		chunk := data[1:]
+		if int(data[0]) < len(chunk) {
+			chunk = chunk[:data[0]]
+		}
+		if words {
+			chunk = chunk[:len(chunk)&^1]
+		}
+		if len(chunk) == 0 {
+			return nil, errors.New("BMC returned an empty FRU chunk")
+		}
+		out = append(out, chunk...)
+	}
+	return out[:count], nil
+}
+
+// fruFields decodes the type/length encoded fields of an info area up to the
+// end marker.
+func fruFields(data []byte) []string {
+	var fields []string
+	for len(data) > 0 && data[0] != fruEndOfFields {
+		n := int(data[0] & 0x3f)
+		if 1+n > len(data) {
+			break
+		}
+		fields = append(fields, fruString(data[0]>>6, data[1:1+n]))
+		data = data[1+n:]
+	}
+	return fields
+}
+
+func fruString(kind uint8, data []byte) string {
+	var b strings.Builder
+	switch kind {
+	case 0x00:
+		for _, v := range data {
+			fmt.Fprintf(&b, "%02Xh ", v)
+		}
+	case 0x01:
+		const bcdPlus = "0123456789 -.???"
+		for _, v := range data {
+			b.WriteByte(bcdPlus[v>>4])
+			b.WriteByte(bcdPlus[v&0x0f])
+		}
+	case 0x02:
+		for i := 0; i < len(data); i += 3 {
+			var packed uint32
+			for j := 0; j < 3 && i+j < len(data); j++ {
+				packed |= uint32(data[i+j]) << (8 * uint(j))
+			}
+			for j := uint(0); j < 4; j++ {
+				b.WriteByte(byte(packed>>(6*j)&0x3f) + 0x20)
+			}
+		}
+	default:
+		b.Write(data)
+	}
+	return strings.TrimSpace(strings.TrimRight(b.String(), "\x00"))
+}
+
+func fieldAt(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+func chassisTypeName(t uint8) string {
+	if name, ok := chassisTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+var chassisTypeNames = map[uint8]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "Desktop",
+	0x04: "Low Profile Desktop",
+	0x05: "Pizza Box",
+	0x06: "Mini Tower",
+	0x07: "Tower",
+	0x08: "Portable",
+	0x09: "LapTop",
+	0x0a: "Notebook",
+	0x0b: "Hand Held",
+	0x0c: "Docking Station",
+	0x0d: "All in One",
+	0x0e: "Sub Notebook",
+	0x0f: "Space-saving",
+	0x10: "Lunch Box",
+	0x11: "Main Server Chassis",
+	0x12: "Expansion Chassis",
+	0x13: "SubChassis",
+	0x14: "Bus Expansion Chassis",
+	0x15: "Peripheral Chassis",
+	0x16: "RAID Chassis",
+	0x17: "Rack Mount Chassis",
+	0x18: "Sealed-case PC",
+	0x19: "Multi-system Chassis",
+	0x1a: "Compact PCI",
+	0x1b: "Advanced TCA",
+	0x1c: "Blade",
+	0x1d: "Blade Enclosure",
+}
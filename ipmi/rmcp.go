@@ -0,0 +1,188 @@
+// Package ipmi implements a minimal IPMI 2.0 (RMCP+) LAN client, covering the
+// commands the exporter needs to scrape a BMC without FreeIPMI.
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	rmcpVersion   = 0x06
+	rmcpNoAck     = 0xff
+	rmcpClassIPMI = 0x07
+
+	authTypeNone     = 0x00
+	authTypeRMCPPlus = 0x06
+
+	payloadIPMI            = 0x00
+	payloadOpenSessionReq  = 0x10
+	payloadOpenSessionResp = 0x11
+	payloadRAKP1           = 0x12
+	payloadRAKP2           = 0x13
+	payloadRAKP3           = 0x14
+	payloadRAKP4           = 0x15
+
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+	payloadTypeMask      = 0x3f
+
+	bmcSlaveAddr = 0x20
+	remoteSWID   = 0x81
+
+	integrityNextHeader = 0x07
+)
+
+// Network function codes used by the exporter.
+const (
+	NetFnChassis        = 0x00
+	NetFnSensorEvent    = 0x04
+	NetFnApp            = 0x06
+	NetFnStorage        = 0x0a
+	NetFnGroupExtension = 0x2c
+)
+
+var errShortPacket = errors.New("short packet")
+
+// CompletionCode is a non-zero IPMI completion code returned by the BMC.
+type CompletionCode uint8
+
+const (
+	CompletionInvalidSessionID    CompletionCode = 0xa1 // OEM, but common for expired sessions
+	CompletionReservationCanceled CompletionCode = 0xc5
+	CompletionCannotReturnBytes   CompletionCode = 0xca
+	CompletionInvalidCommand      CompletionCode = 0xc1
+	CompletionInsufficientPriv    CompletionCode = 0xd4
+)
+
+func (c CompletionCode) Error() string {
+	switch c {
+	case CompletionInvalidCommand:
+		return "invalid command (0xc1)"
+	case CompletionReservationCanceled:
+		return "reservation canceled (0xc5)"
+	case CompletionCannotReturnBytes:
+		return "cannot return requested number of bytes (0xca)"
+	case CompletionInsufficientPriv:
+		return "insufficient privilege level (0xd4)"
+	}
+	return fmt.Sprintf("completion code 0x%02x", uint8(c))
+}
+
+func checksum(b []byte) uint8 {
+	var sum uint8
+	for _, v := range b {
+		sum += v
+	}
+	return -sum
+}
+
+func rmcpHeader() []byte {
+	return []byte{rmcpVersion, 0x00, rmcpNoAck, rmcpClassIPMI}
+}
+
+// ipmiMessage builds a LAN IPMI request message addressed to the BMC.
+func ipmiMessage(netFn, lun, cmd, seq uint8, data []byte) []byte {
+	msg := []byte{bmcSlaveAddr, netFn<<2 | lun&0x03, 0}
+	msg[2] = checksum(msg[:2])
+	msg = append(msg, remoteSWID, seq<<2, cmd)
+	msg = append(msg, data...)
+	return append(msg, checksum(msg[3:]))
+}
+
+type response struct {
+	netFn uint8
+	seq   uint8
+	cmd   uint8
+	code  uint8
+	data  []byte
+}
+
+func parseIPMIResponse(msg []byte) (*response, error) {
+	if len(msg) < 8 {
+		return nil, errShortPacket
+	}
+	if checksum(msg[:2]) != msg[2] || checksum(msg[3:len(msg)-1]) != msg[len(msg)-1] {
+		return nil, errors.New("bad message checksum")
+	}
+	return &response{
+		netFn: msg[1] >> 2,
+		seq:   msg[4] >> 2,
+		cmd:   msg[5],
+		code:  msg[6],
+		data:  msg[7 : len(msg)-1],
+	}, nil
+}
+
+// v15Packet wraps a message in an unauthenticated IPMI 1.5 session header, as
+// used for the pre-session Get Channel Authentication Capabilities request.
+func v15Packet(msg []byte) []byte {
+	pkt := rmcpHeader()
+	pkt = append(pkt, authTypeNone, 0, 0, 0, 0, 0, 0, 0, 0, uint8(len(msg)))
+	return append(pkt, msg...)
+}
+
+type v20Header struct {
+	payloadType uint8
+	sessionID   uint32
+	sequence    uint32
+	payload     []byte
+	// authenticated holds everything from the auth type up to and
+	// including the next header byte, when the packet carries an auth code.
+	authenticated []byte
+	authCode      []byte
+}
+
+func parsePacket(pkt []byte) (*v20Header, error) {
+	if len(pkt) < 4 || pkt[0] != rmcpVersion || pkt[3] != rmcpClassIPMI {
+		return nil, errors.New("not an RMCP IPMI packet")
+	}
+	pkt = pkt[4:]
+	if len(pkt) < 1 {
+		return nil, errShortPacket
+	}
+	switch pkt[0] {
+	case authTypeNone:
+		if len(pkt) < 10 || len(pkt) < 10+int(pkt[9]) {
+			return nil, errShortPacket
+		}
+		return &v20Header{
+			payloadType: payloadIPMI,
+			sequence:    binary.LittleEndian.Uint32(pkt[1:5]),
+			sessionID:   binary.LittleEndian.Uint32(pkt[5:9]),
+			payload:     pkt[10 : 10+int(pkt[9])],
+		}, nil
+	case authTypeRMCPPlus:
+	default:
+		return nil, fmt.Errorf("unsupported authentication type 0x%02x", pkt[0])
+	}
+	if len(pkt) < 12 {
+		return nil, errShortPacket
+	}
+	h := &v20Header{
+		payloadType: pkt[1],
+		sessionID:   binary.LittleEndian.Uint32(pkt[2:6]),
+		sequence:    binary.LittleEndian.Uint32(pkt[6:10]),
+	}
+	n := int(binary.LittleEndian.Uint16(pkt[10:12]))
+	if len(pkt) < 12+n {
+		return nil, errShortPacket
+	}
+	h.payload = pkt[12 : 12+n]
+	if h.payloadType&payloadAuthenticated != 0 {
+		trailer := pkt[12+n:]
+		// Integrity pad and pad length are followed by the next header
+		// byte; whatever follows that is the auth code.
+		i := 0
+		for i < len(trailer) && trailer[i] == 0xff {
+			i++
+		}
+		if i+2 > len(trailer) || int(trailer[i]) != i || trailer[i+1] != integrityNextHeader {
+			return nil, errors.New("malformed integrity trailer")
+		}
+		h.authenticated = pkt[:12+n+i+2]
+		h.authCode = trailer[i+2:]
+	}
+	return h, nil
+}
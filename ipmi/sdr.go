@@ -0,0 +1,413 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	cmdReserveSDRRepository = 0x22
+	cmdGetSDR               = 0x23
+	cmdGetSensorReading     = 0x2d
+	cmdGetSensorThresholds  = 0x27
+
+	sdrTypeFullSensor    = 0x01
+	sdrTypeCompactSensor = 0x02
+
+	sdrHeaderLength   = 5
+	sdrReadChunk      = 16
+	sdrLastRecordID   = 0xffff
+	sdrMaxReservation = 3
+
+	// EventReadingTypeThreshold marks sensors that report threshold based
+	// states rather than discrete events.
+	EventReadingTypeThreshold = 0x01
+)
+
+// SDR is a full or compact sensor data record.
+type SDR struct {
+	RecordID         uint16
+	RecordType       uint8
+	OwnerID          uint8
+	OwnerLUN         uint8
+	SensorNumber     uint8
+	SensorType       uint8
+	EventReadingType uint8
+	Name             string
+
+	// Conversion factors, only set for full sensor records.
+	analogFormat  uint8
+	linearization uint8
+	m, b          int32
+	rExp, bExp    int32
+	units1        uint8
+	baseUnit      uint8
+}
+
+// Analog reports whether readings of the sensor can be converted to a value.
+func (s *SDR) Analog() bool {
+	return s.RecordType == sdrTypeFullSensor && s.analogFormat != 0x03
+}
+
+// TypeName returns the sensor type name as printed by FreeIPMI.
+func (s *SDR) TypeName() string {
+	return SensorTypeName(s.SensorType)
+}
+
+// Unit returns the abbreviation of the sensor's base unit as printed by
+// FreeIPMI, or "N/A" for discrete sensors.
+func (s *SDR) Unit() string {
+	if !s.Analog() {
+		return "N/A"
+	}
+	if s.units1&0x01 != 0 {
+		return "%"
+	}
+	if unit, ok := unitAbbreviations[s.baseUnit]; ok {
+		return unit
+	}
+	return "N/A"
+}
+
+// Convert applies the record's conversion formula to a raw reading.
+func (s *SDR) Convert(raw uint8) float64 {
+	var x int32
+	switch s.analogFormat {
+	case 0x00:
+		x = int32(raw)
+	case 0x01:
+		x = int32(raw)
+		if raw&0x80 != 0 {
+			x -= 0xff
+		}
+	case 0x02:
+		x = int32(int8(raw))
+	default:
+		return math.NaN()
+	}
+	y := (float64(s.m*x) + float64(s.b)*math.Pow10(int(s.bExp))) * math.Pow10(int(s.rExp))
+	switch s.linearization {
+	case 0x01:
+		y = math.Log(y)
+	case 0x02:
+		y = math.Log10(y)
+	case 0x03:
+		y = math.Log2(y)
+	case 0x04:
+		y = math.Exp(y)
+	case 0x05:
+		y = math.Pow(10, y)
+	case 0x06:
+		y = math.Pow(2, y)
+	case 0x07:
+		y = 1 / y
+	case 0x08:
+		y = y * y
+	case 0x09:
+		y = y * y * y
+	case 0x0a:
+		y = math.Sqrt(y)
+	case 0x0b:
+		y = math.Cbrt(y)
+	}
+	return y
+}
+
+func signExtend(v uint32, bits uint) int32 {
+	shift := 32 - bits
+	return int32(v<<shift) >> shift
+}
+
+func parseSDR(rec []byte) (*SDR, error) {
+	if len(rec) < sdrHeaderLength {
+		return nil, errShortPacket
+	}
+	s := &SDR{
+		RecordID:   binary.LittleEndian.Uint16(rec[0:2]),
+		RecordType: rec[3],
+	}
+	var idOffset int
+	switch s.RecordType {
+	case sdrTypeFullSensor:
+		if len(rec) < 48 {
+			return nil, errShortPacket
+		}
+		s.units1 = rec[20]
+		s.analogFormat = rec[20] >> 6
+		s.baseUnit = rec[21]
+		s.linearization = rec[23] & 0x7f
+		s.m = signExtend(uint32(rec[24])|uint32(rec[25]&0xc0)<<2, 10)
+		s.b = signExtend(uint32(rec[26])|uint32(rec[27]&0xc0)<<2, 10)
+		s.rExp = signExtend(uint32(rec[29]>>4), 4)
+		s.bExp = signExtend(uint32(rec[29]&0x0f), 4)
+		idOffset = 47
+	case sdrTypeCompactSensor:
+		if len(rec) < 32 {
+			return nil, errShortPacket
+		}
+		s.units1 = rec[20]
+		s.analogFormat = 0x03
+		idOffset = 31
+	default:
+		return s, nil
+	}
+	s.OwnerID = rec[5]
+	s.OwnerLUN = rec[6] & 0x03
+	s.SensorNumber = rec[7]
+	s.SensorType = rec[12]
+	s.EventReadingType = rec[13] & 0x7f
+	n := int(rec[idOffset] & 0x1f)
+	if idOffset+1+n > len(rec) {
+		n = len(rec) - idOffset - 1
+	}
+	s.Name = string(rec[idOffset+1 : idOffset+1+n])
+	return s, nil
+}
+
+// GetSDRRepository reads all full and compact sensor records owned by the
+// BMC. Records of other types are skipped.
+func (c *Client) GetSDRRepository(ctx context.Context) ([]*SDR, error) {
+	var records []*SDR
+	err := c.walkSDR(ctx, func(id uint16, rec []byte) error {
+		s, err := parseSDR(rec)
+		if err != nil {
+			return fmt.Errorf("parse SDR %d: %w", id, err)
+		}
+		if (s.RecordType == sdrTypeFullSensor || s.RecordType == sdrTypeCompactSensor) && s.OwnerID == bmcSlaveAddr {
+			records = append(records, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// walkSDR calls fn with every raw record of the SDR repository, renewing the
+// reservation when the BMC cancels it.
+func (c *Client) walkSDR(ctx context.Context, fn func(id uint16, rec []byte) error) error {
+	reservation, err := c.reserveSDR(ctx)
+	if err != nil {
+		return err
+	}
+	id := uint16(0)
+	for id != sdrLastRecordID {
+		var rec []byte
+		var next uint16
+		for attempt := 0; ; attempt++ {
+			next, rec, err = c.readSDR(ctx, reservation, id)
+			if err != CompletionReservationCanceled || attempt >= sdrMaxReservation {
+				break
+			}
+			if reservation, err = c.reserveSDR(ctx); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("get SDR %d: %w", id, err)
+		}
+		if err := fn(id, rec); err != nil {
+			return err
+		}
+		if next == id {
+			break
+		}
+		id = next
+	}
+	return nil
+}
+
+func (c *Client) reserveSDR(ctx context.Context) (uint16, error) {
+	data, err := c.Execute(ctx, NetFnStorage, cmdReserveSDRRepository, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 2 {
+		return 0, errShortPacket
+	}
+	return binary.LittleEndian.Uint16(data), nil
+}
+
+func (c *Client) readSDR(ctx context.Context, reservation, id uint16) (uint16, []byte, error) {
+	get := func(offset, count uint8) (uint16, []byte, error) {
+		req := make([]byte, 6)
+		binary.LittleEndian.PutUint16(req[0:2], reservation)
+		binary.LittleEndian.PutUint16(req[2:4], id)
+		req[4], req[5] = offset, count
+		data, err := c.Execute(ctx, NetFnStorage, cmdGetSDR, req)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(data) < 2 {
+			return 0, nil, errShortPacket
+		}
+		return binary.LittleEndian.Uint16(data[0:2]), data[2:], nil
+	}
+
+	next, rec, err := get(0, sdrHeaderLength)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rec) < sdrHeaderLength {
+		return 0, nil, errShortPacket
+	}
+	total := sdrHeaderLength + int(rec[4])
+	for len(rec) < total {
+		count := total - len(rec)
+		if count > sdrReadChunk {
+			count = sdrReadChunk
+		}
+		_, chunk, err := get(uint8(len(rec)), uint8(count))
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(chunk) == 0 {
+			return 0, nil, errors.New("BMC returned an empty SDR chunk")
+		}
+		rec = append(rec, chunk...)
+	}
+	return next, rec[:total], nil
+}
+
+// SensorReading is the response to Get Sensor Reading.
+type SensorReading struct {
+	Raw         uint8
+	Unavailable bool
+	// State holds the threshold comparison status or discrete state bits.
+	State uint16
+}
+
+// Threshold comparison bits of SensorReading.State.
+const (
+	BelowLowerNonCritical    = 0x01
+	BelowLowerCritical       = 0x02
+	BelowLowerNonRecoverable = 0x04
+	AboveUpperNonCritical    = 0x08
+	AboveUpperCritical       = 0x10
+	AboveUpperNonRecoverable = 0x20
+)
+
+// GetSensorReading reads the sensor described by the given record.
+func (c *Client) GetSensorReading(ctx context.Context, s *SDR) (*SensorReading, error) {
+	data, err := c.ExecuteLUN(ctx, NetFnSensorEvent, s.OwnerLUN, cmdGetSensorReading, []byte{s.SensorNumber})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, errShortPacket
+	}
+	r := &SensorReading{
+		Raw:         data[0],
+		Unavailable: data[1]&0x20 != 0 || data[1]&0x40 == 0,
+	}
+	if len(data) > 2 {
+		r.State = uint16(data[2])
+	}
+	if len(data) > 3 {
+		r.State |= uint16(data[3]&0x7f) << 8
+	}
+	return r, nil
+}
+
+// SensorThresholds is the response to Get Sensor Thresholds, converted like
+// readings. Thresholds the BMC does not report are NaN.
+type SensorThresholds struct {
+	LowerNonCritical    float64
+	LowerCritical       float64
+	LowerNonRecoverable float64
+	UpperNonCritical    float64
+	UpperCritical       float64
+	UpperNonRecoverable float64
+}
+
+// GetSensorThresholds reads the thresholds of an analog threshold sensor.
+func (c *Client) GetSensorThresholds(ctx context.Context, s *SDR) (*SensorThresholds, error) {
+	data, err := c.ExecuteLUN(ctx, NetFnSensorEvent, s.OwnerLUN, cmdGetSensorThresholds, []byte{s.SensorNumber})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 7 {
+		return nil, errShortPacket
+	}
+	// The readable mask and the values share the order lower non-critical,
+	// lower critical, lower non-recoverable, upper non-critical, upper
+	// critical, upper non-recoverable.
+	var values [6]float64
+	for i := range values {
+		values[i] = math.NaN()
+		if data[0]&(1<<uint(i)) != 0 {
+			values[i] = s.Convert(data[1+i])
+		}
+	}
+	return &SensorThresholds{
+		LowerNonCritical:    values[0],
+		LowerCritical:       values[1],
+		LowerNonRecoverable: values[2],
+		UpperNonCritical:    values[3],
+		UpperCritical:       values[4],
+		UpperNonRecoverable: values[5],
+	}, nil
+}
+
+var sensorTypeNames = map[uint8]string{
+	0x01: "Temperature",
+	0x02: "Voltage",
+	0x03: "Current",
+	0x04: "Fan",
+	0x05: "Physical Security",
+	0x06: "Platform Security Violation Attempt",
+	0x07: "Processor",
+	0x08: "Power Supply",
+	0x09: "Power Unit",
+	0x0a: "Cooling Device",
+	0x0b: "Other Units Based Sensor",
+	0x0c: "Memory",
+	0x0d: "Drive Slot",
+	0x0e: "POST Memory Resize",
+	0x0f: "System Firmware Progress",
+	0x10: "Event Logging Disabled",
+	0x11: "Watchdog 1",
+	0x12: "System Event",
+	0x13: "Critical Interrupt",
+	0x14: "Button Switch",
+	0x15: "Module Board",
+	0x16: "Microcontroller Coprocessor",
+	0x17: "Add In Card",
+	0x18: "Chassis",
+	0x19: "Chip Set",
+	0x1a: "Other Fru",
+	0x1b: "Cable Interconnect",
+	0x1c: "Terminator",
+	0x1d: "System Boot Initiated",
+	0x1e: "Boot Error",
+	0x1f: "OS Boot",
+	0x20: "OS Critical Stop",
+	0x21: "Slot Connector",
+	0x22: "System ACPI Power State",
+	0x23: "Watchdog 2",
+	0x24: "Platform Alert",
+	0x25: "Entity Presence",
+	0x26: "Monitor ASIC IC",
+	0x27: "LAN",
+	0x28: "Management Subsystem Health",
+	0x29: "Battery",
+	0x2a: "Session Audit",
+	0x2b: "Version Change",
+	0x2c: "FRU State",
+}
+
+var unitAbbreviations = map[uint8]string{
+	0x01: "C",
+	0x02: "F",
+	0x03: "K",
+	0x04: "V",
+	0x05: "A",
+	0x06: "W",
+	0x07: "J",
+	0x12: "RPM",
+	0x13: "Hz",
+}
@@ -0,0 +1,130 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	cmdGetSELInfo  = 0x40
+	cmdGetSELEntry = 0x43
+
+	selRecordLength      = 16
+	selLastRecordID      = 0xffff
+	selTimestampedOEMMin = 0xc0
+	selTimestampedOEMMax = 0xdf
+	// Timestamps up to this value count seconds since BMC initialization
+	// rather than since the epoch.
+	selTimestampPreInit = 0x20000000
+)
+
+// SELRecordTypeSystem is the record type of system event records.
+const SELRecordTypeSystem = 0x02
+
+// SELInfo is the response to Get SEL Info.
+type SELInfo struct {
+	Entries   uint16
+	FreeBytes uint16
+	LastAdd   time.Time
+	LastErase time.Time
+	// Overflow is set when events were dropped because the SEL was full.
+	Overflow bool
+}
+
+// GetSELInfo issues the Get SEL Info command.
+func (c *Client) GetSELInfo(ctx context.Context) (*SELInfo, error) {
+	data, err := c.Execute(ctx, NetFnStorage, cmdGetSELInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 14 {
+		return nil, errShortPacket
+	}
+	return &SELInfo{
+		Entries:   binary.LittleEndian.Uint16(data[1:3]),
+		FreeBytes: binary.LittleEndian.Uint16(data[3:5]),
+		LastAdd:   selTime(data[5:9]),
+		LastErase: selTime(data[9:13]),
+		Overflow:  data[13]&0x80 != 0,
+	}, nil
+}
+
+// SELEntry is a System Event Log record. Sensor fields are only set for
+// system event records.
+type SELEntry struct {
+	RecordID     uint16
+	RecordType   uint8
+	Timestamp    time.Time
+	SensorType   uint8
+	SensorNumber uint8
+	EventType    uint8
+	Deassertion  bool
+	EventData    [3]uint8
+}
+
+// GetSELEntries reads all records of the System Event Log.
+func (c *Client) GetSELEntries(ctx context.Context) ([]*SELEntry, error) {
+	var entries []*SELEntry
+	id := uint16(0)
+	for id != selLastRecordID {
+		req := make([]byte, 6)
+		binary.LittleEndian.PutUint16(req[2:4], id)
+		req[5] = 0xff
+		data, err := c.Execute(ctx, NetFnStorage, cmdGetSELEntry, req)
+		if err != nil {
+			return nil, fmt.Errorf("get SEL entry %d: %w", id, err)
+		}
+		if len(data) < 2+selRecordLength {
+			return nil, errShortPacket
+		}
+		next := binary.LittleEndian.Uint16(data[0:2])
+		entries = append(entries, parseSELEntry(data[2:2+selRecordLength]))
+		if next == id {
+			break
+		}
+		id = next
+	}
+	return entries, nil
+}
+
+func parseSELEntry(rec []byte) *SELEntry {
+	e := &SELEntry{
+		RecordID:   binary.LittleEndian.Uint16(rec[0:2]),
+		RecordType: rec[2],
+	}
+	if e.RecordType == SELRecordTypeSystem ||
+		(e.RecordType >= selTimestampedOEMMin && e.RecordType <= selTimestampedOEMMax) {
+		e.Timestamp = selTime(rec[3:7])
+	}
+	if e.RecordType == SELRecordTypeSystem {
+		e.SensorType = rec[10]
+		e.SensorNumber = rec[11]
+		e.Deassertion = rec[12]&0x80 != 0
+		e.EventType = rec[12] & 0x7f
+		copy(e.EventData[:], rec[13:16])
+	}
+	return e
+}
+
+// selTime converts a SEL timestamp, returning the zero time for unspecified
+// or pre-init timestamps.
+func selTime(b []byte) time.Time {
+	ts := binary.LittleEndian.Uint32(b)
+	if ts == 0xffffffff || ts <= selTimestampPreInit {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts), 0)
+}
+
+// SensorTypeName returns the FreeIPMI name for a sensor type code.
+func SensorTypeName(sensorType uint8) string {
+	if name, ok := sensorTypeNames[sensorType]; ok {
+		return name
+	}
+	if sensorType >= 0xc0 {
+		return "OEM Reserved"
+	}
+	return "Unknown"
+}
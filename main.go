@@ -2,81 +2,259 @@ package main
 
 import (
 	"context"
+	"fmt"
 	log "github.com/cihub/seelog"
-	"github.com/jinzhu/configor"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/robfig/cron/v3"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	config    = Config{}
+	// config is replaced on reload, guarded by lock. Use currentConfig or
+	// the config of a target instead of reading it directly.
+	config    = &Config{}
 	lock      sync.RWMutex
-	metrics   []prometheus.Metric
+	// scheduler runs flush every Global.Interval seconds, guarded by
+	// scheduleMu so reloads can reschedule it.
+	scheduler  *cron.Cron
+	flushEntry cron.EntryID
+	scheduleMu sync.Mutex
+	// flushing is set while a collection cycle runs.
+	flushing int32
 	configDir = kingpin.Flag(
 		"config.dir",
 		"dir of configuration file.",
 	).String()
+	recordDir = kingpin.Flag(
+		"record.dir",
+		"dir to record FreeIPMI output into as replay fixtures, off if empty.",
+	).String()
+	recordKeep = kingpin.Flag(
+		"record.keep",
+		"number of recorded collections to keep per host, all if 0.",
+	).Default("10").Int()
 )
 
 func inst() {
-	err := configor.Load(&config, *configDir + "/config.yml")
-	if err != nil {
-		log.Errorf("Error parsing config file: %s", err)
-	}
+	c, err := loadConfig()
 	defer log.Flush()
-	logger, err := log.LoggerFromConfigAsFile(*configDir + "/logconf.xml")
-	if err != nil {
-		log.Errorf("parse logconfig.xml err: %v", err)
+	logger, logErr := log.LoggerFromConfigAsFile(*configDir + "/logconf.xml")
+	if logErr != nil {
+		log.Errorf("parse logconfig.xml err: %v", logErr)
 	}
 	log.ReplaceLogger(logger)
+	if err != nil {
+		log.Errorf("Error parsing config file: %s", err)
+	} else {
+		configReloadSuccess.Set(1)
+		configReloadSeconds.SetToCurrentTime()
+	}
+	lock.Lock()
+	config = c
+	lock.Unlock()
 }
 
 func remoteIPMIHandler(w http.ResponseWriter, r *http.Request) {
 	registry := prometheus.NewRegistry()
 	remoteCollector := collector{}
 	registry.MustRegister(remoteCollector)
+	registry.MustRegister(sessionLogins, sessionRelogins, sessionReuses)
+	registry.MustRegister(configReloadSuccess, configReloadSeconds, collectorTimeouts, commandFailures, scrapeErrors, sensorParseErrors)
+	registry.MustRegister(schedulerQueueDepth, schedulerInFlight, schedulerSkippedCycles)
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 }
 
+// findTarget looks up a target of c by host.
+func findTarget(c *Config, host string) (ipmiTarget, bool) {
+	for _, target := range c.Targets {
+		if target.Host == host {
+			return target, true
+		}
+	}
+	return ipmiTarget{}, false
+}
+
+// hostCollector passes on only the metrics of the wrapped collector whose
+// host label is host.
+type hostCollector struct {
+	prometheus.Collector
+	host string
+}
+
+// Collect implements Prometheus.Collector.
+func (c hostCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collector.Collect(metrics)
+		close(metrics)
+	}()
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		for _, label := range m.Label {
+			if label.GetName() == "host" && label.GetValue() == c.host {
+				ch <- metric
+				break
+			}
+		}
+	}
+}
+
+// targetIPMIHandler exposes only the target given by the target parameter,
+// so Prometheus can scrape and relabel each BMC separately. Credentials come
+// from the configured target with that host. Until the target is due again,
+// which includes its backoff, the cached result of its last collection is
+// served; otherwise it is collected right away and the result cached. A
+// module other than the configured one is always collected right away.
+func targetIPMIHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("target")
+	if host == "" {
+		http.Error(w, "'target' parameter must be specified", http.StatusBadRequest)
+		return
+	}
+	c := currentConfig()
+	target, ok := findTarget(c, host)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown target '%s'", host), http.StatusBadRequest)
+		return
+	}
+	configured := true
+	if module := r.URL.Query().Get("module"); module != "" && module != target.Module {
+		if _, ok := c.Modules[module]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown module '%s'", module), http.StatusBadRequest)
+			return
+		}
+		target.Module = module
+		configured = false
+	}
+	registry := prometheus.NewRegistry()
+	if configured && !targetDue(target.Host, time.Now(), baseInterval(c)) {
+		log.Debugf("Serving cached result of target %s", target.Host)
+		registry.MustRegister(hostCollector{Collector: collector{}, host: target.Host})
+	} else {
+		log.Debugf("Scraping target %s", target.Host)
+		ctx, cancel := targetContext(r.Context(), c.Global.TimeOut)
+		defer cancel()
+		registry.MustRegister(targetCollector{ctx: ctx, target: target, store: configured})
+	}
+	// Only the series of this target, as Prometheus attaches its instance
+	// label to all of them. Metrics of the exporter itself are left to
+	// /metrics.
+	for _, c := range []prometheus.Collector{sessionLogins, sessionRelogins, sessionReuses, collectorTimeouts, scrapeErrors, sensorParseErrors} {
+		registry.MustRegister(hostCollector{Collector: c, host: target.Host})
+	}
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+}
+
+// targetContext bounds the collection of one target by timeout seconds.
+func targetContext(parent context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, time.Second*time.Duration(timeout))
+	}
+	return context.WithCancel(parent)
+}
+
 func flush() {
-	var targetMetrics []prometheus.Metric
+	// Overlapping cycles would only pile up more FreeIPMI processes on BMCs
+	// that are already slow to answer.
+	if !atomic.CompareAndSwapInt32(&flushing, 0, 1) {
+		schedulerSkippedCycles.Inc()
+		log.Warn("Previous collection cycle is still running, skipping this one")
+		return
+	}
+	defer atomic.StoreInt32(&flushing, 0)
+
+	start := time.Now()
+	// The whole cycle works with the configuration it started with.
+	c := currentConfig()
+	base := baseInterval(c)
+	var targets []ipmiTarget
+	for _, target := range c.Targets {
+		if targetDue(target.Host, start, base) {
+			targets = append(targets, target)
+		}
+	}
+	timeout := c.Global.TimeOut
+	jitter := c.Global.Jitter
+	slots := make(chan struct{}, concurrency(c))
+	schedulerQueueDepth.Set(float64(len(targets)))
 	wg := sync.WaitGroup{}
-	wg.Add(len(config.Targets))
-	for i := 0; i < len(config.Targets); i++ {
+	wg.Add(len(targets))
+	for i := 0; i < len(targets); i++ {
 		go func(i int) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(config.Global.TimeOut))
+			time.Sleep(targetOffset(targets[i].Host, jitter))
+			slots <- struct{}{}
+			schedulerQueueDepth.Dec()
+			schedulerInFlight.Inc()
+			ctx, cancel := targetContext(context.Background(), timeout)
 			defer cancel()
-			targetMetrics = append(targetMetrics, IpmiCollect(config.Targets[i])...)
+			collected, status := IpmiCollect(ctx, targets[i])
+			storeResult(targets[i].Host, collected, status.ok())
+			recordScrape(targets[i], start, base, status)
 			select {
 			case <-ctx.Done():
-				log.Error("收到超时信号,采集退出", config.Targets[i].Host)
+				if ctx.Err() == context.DeadlineExceeded {
+					log.Error("收到超时信号,采集退出", targets[i].Host)
+				}
 			default:
-				//log.Info(config.Targets[i].Host,":指标采集完成",len(targetMetrics))
+				//log.Info(targets[i].Host,":指标采集完成")
 			}
+			schedulerInFlight.Dec()
+			<-slots
 			wg.Done()
 		}(i)
 	}
 	wg.Wait()
+}
 
-	//统一写操作
-	lock.Lock()
-	metrics = targetMetrics
-	defer lock.Unlock()
+// cronSpec runs a job every interval seconds.
+func cronSpec(interval string) string {
+	return "*/" + interval + " * * * * *"
+}
+
+// reschedule replaces the flush job after the interval changed.
+func reschedule(interval string) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	if scheduler == nil {
+		return nil
+	}
+	id, err := scheduler.AddFunc(cronSpec(interval), flush)
+	if err != nil {
+		return err
+	}
+	scheduler.Remove(flushEntry)
+	flushEntry = id
+	log.Infof("Rescheduled collection every %s seconds", interval)
+	return nil
 }
 
 func Manage() {
 	//Create a cron manager
 	log.Info("Create a cron manager")
-	c := cron.New(cron.WithSeconds())
-	c.AddFunc("*/"+config.Global.Interval+" * * * * *", flush)
+	scheduleMu.Lock()
+	c := currentConfig()
+	interval := c.Global.Interval
+	scheduler = cron.New(cron.WithSeconds())
+	var err error
+	flushEntry, err = scheduler.AddFunc(cronSpec(interval), flush)
+	if err != nil {
+		log.Errorf("Failed to schedule collection every %s seconds: %s", interval, err)
+	}
 	//Run func every min
-	c.Start()
+	scheduler.Start()
+	scheduleMu.Unlock()
+	sessions.configureKeepalive(c)
 	select {}
 }
 
@@ -85,12 +263,16 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 	inst()
+	address := currentConfig().Global.Address
 	go Manage()
+	go watchSIGHUP()
 
 	http.HandleFunc("/metrics", remoteIPMIHandler) // Endpoint to do IPMI scrapes.
-	log.Infof("Listening on %s", config.Global.Address)
-	log.Info(config.Global.Address)
-	err := http.ListenAndServe(config.Global.Address, nil)
+	http.HandleFunc("/ipmi", targetIPMIHandler)    // Endpoint to scrape a single target.
+	http.HandleFunc("/-/reload", reloadHandler)    // Endpoint to reload the configuration.
+	log.Infof("Listening on %s", address)
+	log.Info(address)
+	err := http.ListenAndServe(address, nil)
 	if err != nil {
 		log.Error(err)
 	}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTargetIPMIHandlerBackoff(t *testing.T) {
+	dir := *configDir
+	*configDir = "testdata"
+	defer func() { *configDir = dir }()
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	old := config
+	config = c
+	lock.Unlock()
+	defer func() {
+		lock.Lock()
+		config = old
+		delete(results, "failing")
+		lock.Unlock()
+		forgetSchedule("failing")
+		forgetLastErrors("failing")
+	}()
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		targetIPMIHandler(w, httptest.NewRequest("GET", "/ipmi?target=failing", nil))
+		return w.Body.String()
+	}
+	up := `ipmi_up{collector="ipmimonitoring",host="failing"} 0`
+
+	// The first request collects the target, which fails and backs it off.
+	live := scrape()
+	if !strings.Contains(live, up) || strings.Contains(live, "ipmi_scrape_consecutive_failures") {
+		t.Fatalf("expected a live collection, got:\n%s", live)
+	}
+	// Until the backoff is over the cached result is served.
+	cached := scrape()
+	if !strings.Contains(cached, up) || !strings.Contains(cached, `ipmi_scrape_consecutive_failures{host="failing"} 1`) {
+		t.Errorf("expected the cached result, got:\n%s", cached)
+	}
+}
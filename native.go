@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	log "github.com/cihub/seelog"
+	"github.com/soundcloud/ipmi_exporter/ipmi"
+)
+
+const (
+	backendFreeIPMI = "freeipmi"
+	backendNative   = "native"
+)
+
+// nativeBackend reports whether collectors talk to the BMC through the
+// built-in RMCP+ client instead of forking FreeIPMI.
+func nativeBackend(c *Config) bool {
+	return c.Global.Backend == backendNative
+}
+
+// nativeTarget reports whether target is collected with the native client.
+// Replayed targets always go through the FreeIPMI parsers.
+func nativeTarget(target ipmiTarget) bool {
+	return nativeBackend(target.settings()) && !target.Replay.enabled()
+}
+
+func withNativeSession(ctx context.Context, target ipmiTarget, fn func(ctx context.Context, client *ipmi.Client) error) error {
+	ctx, cancel := commandContext(ctx, target)
+	defer cancel()
+	return sessions.withSession(ctx, target, func(client *ipmi.Client) error {
+		return fn(ctx, client)
+	})
+}
+
+func nativeSensorData(ctx context.Context, target ipmiTarget) ([]sensorData, error) {
+	var result []sensorData
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		records, err := client.GetSDRRepository(ctx)
+		if err != nil {
+			return err
+		}
+		result = nil
+		for _, sdr := range records {
+			reading, err := client.GetSensorReading(ctx, sdr)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Debugf("Failed to read sensor %d (%s) from %s: %s", sdr.RecordID, sdr.Name, target.Host, err)
+				continue
+			}
+			result = append(result, convertSensorReading(sdr, reading))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// nativeSensorThresholds returns the reading and thresholds of every analog
+// threshold sensor, like ipmi-sensors --output-sensor-thresholds.
+func nativeSensorThresholds(ctx context.Context, target ipmiTarget) ([]sensorThresholds, error) {
+	var result []sensorThresholds
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		records, err := client.GetSDRRepository(ctx)
+		if err != nil {
+			return err
+		}
+		result = nil
+		for _, sdr := range records {
+			if !sdr.Analog() || sdr.EventReadingType != ipmi.EventReadingTypeThreshold {
+				continue
+			}
+			thresholds, err := client.GetSensorThresholds(ctx, sdr)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Debugf("Failed to read thresholds of sensor %d (%s) from %s: %s", sdr.RecordID, sdr.Name, target.Host, err)
+				continue
+			}
+			sensor := sensorThresholds{
+				ID:         int64(sdr.RecordID),
+				Name:       sdr.Name,
+				Type:       sdr.TypeName(),
+				Value:      math.NaN(),
+				Thresholds: make(map[string]float64),
+			}
+			if reading, err := client.GetSensorReading(ctx, sdr); err == nil && !reading.Unavailable {
+				sensor.Value = sdr.Convert(reading.Raw)
+			}
+			for name, value := range map[string]float64{
+				"lower_non_recoverable": thresholds.LowerNonRecoverable,
+				"lower_critical":        thresholds.LowerCritical,
+				"lower_non_critical":    thresholds.LowerNonCritical,
+				"upper_non_critical":    thresholds.UpperNonCritical,
+				"upper_critical":        thresholds.UpperCritical,
+				"upper_non_recoverable": thresholds.UpperNonRecoverable,
+			} {
+				if !math.IsNaN(value) {
+					sensor.Thresholds[name] = value
+				}
+			}
+			if len(sensor.Thresholds) > 0 {
+				result = append(result, sensor)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// convertSensorReading maps a native reading onto the fields ipmimonitoring
+// would have printed for the same sensor.
+func convertSensorReading(sdr *ipmi.SDR, reading *ipmi.SensorReading) sensorData {
+	data := sensorData{
+		ID:    int64(sdr.RecordID),
+		Name:  sdr.Name,
+		Type:  sdr.TypeName(),
+		State: "N/A",
+		Value: math.NaN(),
+		Unit:  sdr.Unit(),
+	}
+	if reading.Unavailable {
+		return data
+	}
+	if sdr.Analog() {
+		data.Value = sdr.Convert(reading.Raw)
+	}
+	// The offsets asserted by discrete sensors only gain a meaning through
+	// the sensor type, which FreeIPMI spells out in its event strings. The
+	// native backend does not have those, so it exports no events for them.
+	if sdr.EventReadingType != ipmi.EventReadingTypeThreshold {
+		return data
+	}
+	switch {
+	case reading.State&(ipmi.BelowLowerCritical|ipmi.BelowLowerNonRecoverable|
+		ipmi.AboveUpperCritical|ipmi.AboveUpperNonRecoverable) != 0:
+		data.State = "Critical"
+	case reading.State&(ipmi.BelowLowerNonCritical|ipmi.AboveUpperNonCritical) != 0:
+		data.State = "Warning"
+	default:
+		data.State = "Nominal"
+	}
+	return data
+}
+
+func nativeDCMIPower(ctx context.Context, target ipmiTarget) (dcmiPower, error) {
+	var power dcmiPower
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		reading, err := client.GetPowerReading(ctx)
+		if err != nil {
+			return err
+		}
+		power = dcmiPower{
+			Current: float64(reading.Current),
+			Minimum: float64(reading.Minimum),
+			Maximum: float64(reading.Maximum),
+			Average: float64(reading.Average),
+			Period:  reading.Period.Seconds(),
+			Active:  reading.Active,
+		}
+		return nil
+	})
+	return power, err
+}
+
+// nativeChassisStatus returns the chassis status keyed and worded the way
+// ipmi-chassis --get-status prints it.
+func nativeChassisStatus(ctx context.Context, target ipmiTarget) (map[string]string, error) {
+	var status *ipmi.ChassisStatus
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		var err error
+		status, err = client.GetChassisStatus(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{
+		chassisPowerKey:         onOff(status.PowerOn),
+		"Power overload":        fmt.Sprint(status.PowerOverload),
+		"Interlock":             activeInactive(status.Interlock),
+		"Power fault":           fmt.Sprint(status.PowerFault),
+		"Power control fault":   fmt.Sprint(status.PowerControlFault),
+		chassisRestorePolicyKey: restorePolicyValues[status.RestorePolicy],
+		chassisLastEventKey:     lastPowerEvent(status.LastPowerEvent),
+		"Chassis intrusion":     activeInactive(status.Intrusion),
+		"Front panel lockout":   activeInactive(status.FrontPanelLockout),
+		chassisDriveKey:         fmt.Sprint(status.DriveFault),
+		chassisCoolingKey:       fmt.Sprint(status.CoolingFault),
+	}
+	if status.IdentifySupported {
+		values[chassisIdentifyKey] = identifyStateValues[status.IdentifyState]
+	}
+	return values, nil
+}
+
+// nativeBMCInfo returns the device and channel details keyed the way
+// bmc-info prints them.
+func nativeBMCInfo(ctx context.Context, target ipmiTarget) (bmcInfo, error) {
+	info := bmcInfo{device: make(map[string]string)}
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		id, err := client.GetDeviceID(ctx)
+		if err != nil {
+			return err
+		}
+		info.device["Firmware Revision"] = fmt.Sprintf("%d.%02x", id.FirmwareMajor, id.FirmwareMinor)
+		info.device["IPMI Version"] = fmt.Sprintf("%d.%d", id.IPMIVersionMajor, id.IPMIVersionMinor)
+		info.device["Manufacturer ID"] = strconv.FormatUint(uint64(id.ManufacturerID), 10)
+		info.device["Product ID"] = strconv.FormatUint(uint64(id.ProductID), 10)
+		// The GUID is optional, BMCs without one reject the command.
+		if guid, err := client.GetSystemGUID(ctx); err == nil {
+			info.device["GUID"] = formatGUID(guid)
+		}
+		info.channels = nil
+		for channel := uint8(0); channel <= maxLANChannel; channel++ {
+			ch, err := client.GetChannelInfo(ctx, channel)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				continue
+			}
+			info.channels = append(info.channels, map[string]string{
+				"Channel Number":       strconv.Itoa(int(ch.Number)),
+				"Medium Type":          mediumTypes[ch.MediumType],
+				"Protocol Type":        protocolTypes[ch.ProtocolType],
+				"Session Support":      sessionSupport[ch.SessionSupport],
+				"Active Session Count": strconv.Itoa(int(ch.ActiveSessions)),
+			})
+		}
+		return nil
+	})
+	return info, err
+}
+
+// nativeSEL returns the SEL size and entries. Event states are not
+// interpreted by the native backend and are reported as unknown.
+func nativeSEL(ctx context.Context, target ipmiTarget) (selLog, error) {
+	var sel selLog
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		info, err := client.GetSELInfo(ctx)
+		if err != nil {
+			return err
+		}
+		sel = selLog{
+			Entries:   float64(info.Entries),
+			FreeBytes: float64(info.FreeBytes),
+		}
+		if info.Entries == 0 {
+			return nil
+		}
+		entries, err := client.GetSELEntries(ctx)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			entry := selEntry{
+				ID:        int64(e.RecordID),
+				Timestamp: e.Timestamp,
+				Type:      "OEM Reserved",
+				State:     selUnknownSeverity,
+			}
+			if e.RecordType == ipmi.SELRecordTypeSystem {
+				entry.Type = ipmi.SensorTypeName(e.SensorType)
+				entry.State = selSeverity(e)
+			}
+			sel.Records = append(sel.Records, entry)
+		}
+		return nil
+	})
+	return sel, err
+}
+
+// Generic event types of the IPMI specification whose offsets have a fixed
+// severity, next to ipmi.EventReadingTypeThreshold.
+const (
+	eventTypeSeverity   = 0x07
+	eventTypeRedundancy = 0x0b
+)
+
+// selSeverities maps the offsets of generic event types to the state ipmi-sel
+// prints for them.
+var selSeverities = map[uint8][]string{
+	// Lower and upper non-critical, critical and non-recoverable, each going
+	// low and going high.
+	ipmi.EventReadingTypeThreshold: {
+		"Warning", "Warning", "Critical", "Critical", "Critical", "Critical",
+		"Warning", "Warning", "Critical", "Critical", "Critical", "Critical",
+	},
+	// Transition to OK, non-critical, critical and non-recoverable, then
+	// monitor and informational.
+	eventTypeSeverity: {
+		"Nominal", "Warning", "Critical", "Critical", "Warning", "Critical",
+		"Critical", "Nominal", "Nominal",
+	},
+	// Fully redundant, lost, degraded and the non-redundant states.
+	eventTypeRedundancy: {
+		"Nominal", "Critical", "Warning", "Warning", "Warning", "Critical",
+		"Warning", "Warning",
+	},
+}
+
+// selSeverity returns the state of a system event record. Sensor-specific
+// and OEM events depend on interpretation rules of FreeIPMI the native
+// backend lacks, so they keep the unknown severity.
+func selSeverity(e *ipmi.SELEntry) string {
+	severities, ok := selSeverities[e.EventType]
+	if !ok {
+		return selUnknownSeverity
+	}
+	offset := int(e.EventData[0] & 0x0f)
+	if offset >= len(severities) {
+		return selUnknownSeverity
+	}
+	if e.Deassertion {
+		return "Nominal"
+	}
+	return severities[offset]
+}
+
+// formatGUID prints a GUID most significant byte first, like bmc-info.
+func formatGUID(guid []byte) string {
+	b := make([]byte, len(guid))
+	for i := range guid {
+		b[i] = guid[len(guid)-1-i]
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// maxLANChannel is the highest channel number probed for channel info;
+// 0Eh and 0Fh are aliases for the current channel and system interface.
+const maxLANChannel = 0x0b
+
+var mediumTypes = map[uint8]string{
+	0x01: "IPMB (I2C)",
+	0x02: "ICMB v1.0",
+	0x03: "ICMB v0.9",
+	0x04: "802.3 LAN",
+	0x05: "Asynch. Serial/Modem (RS-232)",
+	0x06: "Other LAN",
+	0x07: "PCI SMBus",
+	0x08: "SMBus v1.0/v1.1",
+	0x09: "SMBus v2.0",
+	0x0a: "USB 1.x",
+	0x0b: "USB 2.x",
+	0x0c: "System Interface (KCS, SMIC, or BT)",
+}
+
+var protocolTypes = map[uint8]string{
+	0x01: "IPMB-1.0",
+	0x02: "ICMB-1.0",
+	0x04: "IPMI-SMBus",
+	0x05: "KCS",
+	0x06: "SMIC",
+	0x07: "BT-10",
+	0x08: "BT-15",
+	0x09: "TMODE",
+}
+
+var sessionSupport = map[uint8]string{
+	0x00: "session-less",
+	0x01: "single-session",
+	0x02: "multi-session",
+	0x03: "session-based",
+}
+
+// lastPowerEvent picks the cause ipmi-chassis would print, checking the
+// bits in the same order.
+func lastPowerEvent(event uint8) string {
+	for i, bit := range []uint8{
+		ipmi.PowerEventACFailed,
+		ipmi.PowerEventOverload,
+		ipmi.PowerEventInterlock,
+		ipmi.PowerEventFault,
+		ipmi.PowerEventIPMICommand,
+	} {
+		if event&bit != 0 {
+			return lastPowerEventValues[i]
+		}
+	}
+	return lastPowerEventValues[len(lastPowerEventValues)-1]
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func activeInactive(b bool) string {
+	if b {
+		return "active"
+	}
+	return "inactive"
+}
+
+// nativeFRU reads the FRU inventory, keyed and worded the way ipmi-fru prints
+// it. Devices that cannot be read are skipped, like ipmi-fru does.
+func nativeFRU(ctx context.Context, target ipmiTarget) ([]fruDevice, error) {
+	var result []fruDevice
+	err := withNativeSession(ctx, target, func(ctx context.Context, client *ipmi.Client) error {
+		result = nil
+		devices, err := client.GetFRUDevices(ctx)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			inv, err := client.ReadFRU(ctx, device.ID)
+			if err != nil {
+				log.Debugf("Failed to read FRU %d (%s) from %s: %s", device.ID, device.Name, target.Host, err)
+				continue
+			}
+			fields := map[string]string{
+				"Chassis Type":              inv.ChassisType,
+				"Chassis Part Number":       inv.ChassisPartNumber,
+				"Chassis Serial Number":     inv.ChassisSerialNumber,
+				"Board Manufacturer":        inv.BoardManufacturer,
+				"Board Product Name":        inv.BoardProductName,
+				"Board Serial Number":       inv.BoardSerialNumber,
+				"Board Part Number":         inv.BoardPartNumber,
+				"Product Manufacturer Name": inv.ProductManufacturer,
+				"Product Name":              inv.ProductName,
+				"Product Part/Model Number": inv.ProductPartNumber,
+				"Product Version":           inv.ProductVersion,
+				"Product Serial Number":     inv.ProductSerialNumber,
+				"Product Asset Tag":         inv.ProductAssetTag,
+			}
+			if !inv.BoardManufactured.IsZero() {
+				fields[fruManufactureDateKey] = inv.BoardManufactured.Format(fruDateTimeLayout)
+			}
+			for key, value := range fields {
+				if value == "" {
+					delete(fields, key)
+				}
+			}
+			result = append(result, fruDevice{
+				ID:     strconv.Itoa(int(device.ID)),
+				Name:   device.Name,
+				Fields: fields,
+			})
+		}
+		return nil
+	})
+	return result, err
+}
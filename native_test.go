@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/soundcloud/ipmi_exporter/ipmi"
+)
+
+func TestSELSeverity(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ipmi.SELEntry
+		state string
+	}{
+		{
+			name:  "upper non-critical going high",
+			entry: ipmi.SELEntry{EventType: ipmi.EventReadingTypeThreshold, EventData: [3]uint8{0x57, 42, 42}},
+			state: "Warning",
+		},
+		{
+			name:  "lower critical going low",
+			entry: ipmi.SELEntry{EventType: ipmi.EventReadingTypeThreshold, EventData: [3]uint8{0x02}},
+			state: "Critical",
+		},
+		{
+			name:  "threshold deasserted",
+			entry: ipmi.SELEntry{EventType: ipmi.EventReadingTypeThreshold, Deassertion: true, EventData: [3]uint8{0x09}},
+			state: "Nominal",
+		},
+		{
+			name:  "transition to critical",
+			entry: ipmi.SELEntry{EventType: eventTypeSeverity, EventData: [3]uint8{0x02}},
+			state: "Critical",
+		},
+		{
+			name:  "redundancy degraded",
+			entry: ipmi.SELEntry{EventType: eventTypeRedundancy, EventData: [3]uint8{0x02}},
+			state: "Warning",
+		},
+		{
+			name:  "fully redundant",
+			entry: ipmi.SELEntry{EventType: eventTypeRedundancy, EventData: [3]uint8{0x00}},
+			state: "Nominal",
+		},
+		{
+			name:  "offset out of range",
+			entry: ipmi.SELEntry{EventType: eventTypeRedundancy, EventData: [3]uint8{0x0e}},
+			state: selUnknownSeverity,
+		},
+		{
+			name:  "sensor-specific",
+			entry: ipmi.SELEntry{EventType: 0x6f, SensorType: 0x08, EventData: [3]uint8{0x01}},
+			state: selUnknownSeverity,
+		},
+	}
+	for _, test := range tests {
+		if state := selSeverity(&test.entry); state != test.state {
+			t.Errorf("%s: expected %s, got %s", test.name, test.state, state)
+		}
+	}
+}
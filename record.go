@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// recordingDir returns the directory below --record.dir that the collection
+// of target started at start is recorded into, one per host and collection,
+// so the capture of a failed collection is not overwritten by the next one.
+func recordingDir(target ipmiTarget, start time.Time) string {
+	host := strings.Replace(target.Host, string(filepath.Separator), "_", -1)
+	return filepath.Join(*recordDir, host, start.Format("20060102T150405.000"))
+}
+
+// pruneRecordings removes the oldest recorded collections of target so that
+// with the one about to be recorded at most --record.keep are left.
+func pruneRecordings(target ipmiTarget) {
+	if *recordKeep <= 0 {
+		return
+	}
+	dir := filepath.Dir(target.recording)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Failed to prune recordings of %s: %s", target.Host, err)
+		}
+		return
+	}
+	// ReadDir sorts by name, which sorts the timestamps oldest first.
+	var recordings []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			recordings = append(recordings, entry.Name())
+		}
+	}
+	for len(recordings) >= *recordKeep {
+		if err := os.RemoveAll(filepath.Join(dir, recordings[0])); err != nil {
+			log.Errorf("Failed to prune recordings of %s: %s", target.Host, err)
+			return
+		}
+		recordings = recordings[1:]
+	}
+}
+
+// recordOutput saves the output of a FreeIPMI command as a replay fixture in
+// the recording directory of the target, so that directory can be used as
+// its replay dir: stdout of a successful command in <fixture>.txt, stderr in
+// <fixture>.stderr. The user name and password are scrubbed from both;
+// stderr also had the credentials passed on the command line redacted by
+// ipmiOutput.
+func recordOutput(target ipmiTarget, fixture string, result commandResult, cmdErr error) {
+	dir := target.recording
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Errorf("Failed to record %s output of %s: %s", fixture, target.Host, err)
+		return
+	}
+	secrets := []string{target.User, target.password}
+	var err error
+	// Only a failed command leaves out the stdout fixture, which is how
+	// replay tells the two apart.
+	if cmdErr == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, fixture+fixtureStdoutExt), []byte(redactSecrets(string(result.Stdout), secrets)), 0600)
+	}
+	if err == nil && (cmdErr != nil || len(result.Stderr) > 0) {
+		err = ioutil.WriteFile(filepath.Join(dir, fixture+fixtureStderrExt), []byte(redactSecrets(string(result.Stderr), secrets)), 0600)
+	}
+	if err != nil {
+		log.Errorf("Failed to record %s output of %s: %s", fixture, target.Host, err)
+	}
+}
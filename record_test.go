@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPruneRecordings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldDir, oldKeep := *recordDir, *recordKeep
+	defer func() { *recordDir, *recordKeep = oldDir, oldKeep }()
+	*recordDir, *recordKeep = dir, 3
+
+	target := ipmiTarget{Host: "hp"}
+	start := time.Date(2020, 7, 1, 15, 12, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		target.recording = recordingDir(target, start.Add(time.Duration(i)*time.Minute))
+		pruneRecordings(target)
+		if err := os.MkdirAll(target.recording, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "hp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+	expected := []string{"20200701T151400.000", "20200701T151500.000", "20200701T151600.000"}
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected %v to be kept, got %v", expected, kept)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/jinzhu/configor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		},
+	)
+
+	configReloadSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		},
+	)
+
+	// reloadMu serializes reloads triggered by SIGHUP and /-/reload.
+	reloadMu sync.Mutex
+)
+
+// loadConfig reads and validates config.yml from the config directory. The
+// returned config is not to be modified once it is in use.
+func loadConfig() (*Config, error) {
+	c := &Config{}
+	if err := configor.Load(c, *configDir+"/config.yml"); err != nil {
+		return c, err
+	}
+	for i := range c.Targets {
+		c.Targets[i].config = c
+	}
+	if err := validateConfig(c); err != nil {
+		return c, err
+	}
+	return c, resolvePasswords(c)
+}
+
+// validateConfig checks c for settings the exporter cannot work with. An
+// unknown backend is also replaced by freeipmi, so a config that fails
+// validation at startup still runs.
+func validateConfig(c *Config) error {
+	switch c.Global.Backend {
+	case "":
+		c.Global.Backend = backendFreeIPMI
+	case backendFreeIPMI, backendNative:
+	default:
+		backend := c.Global.Backend
+		c.Global.Backend = backendFreeIPMI
+		return fmt.Errorf("unknown backend %s", backend)
+	}
+	interval, err := strconv.Atoi(c.Global.Interval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid interval '%s'", c.Global.Interval)
+	}
+	if c.Global.Jitter >= interval {
+		return fmt.Errorf("jitter %d must be shorter than the interval of %d seconds", c.Global.Jitter, interval)
+	}
+	// A target that is collected or backed off less often than results
+	// are kept would drop out of /metrics instead of reporting up=0.
+	staleness := time.Second * time.Duration(c.Global.Staleness)
+	if backoff := maxBackoff(c); staleness > 0 && staleness <= backoff {
+		return fmt.Errorf("staleness of %s must be longer than the maximum backoff of %s", staleness, backoff)
+	}
+	if err := c.Global.SensorNames.validate(); err != nil {
+		return err
+	}
+	if err := c.Global.SensorFilter.validate(); err != nil {
+		return err
+	}
+	for name, module := range c.Modules {
+		if err := module.SensorNames.validate(); err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+		if err := module.SensorFilter.validate(); err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+	}
+	hosts := make(map[string]bool)
+	for _, target := range c.Targets {
+		if hosts[target.Host] {
+			return fmt.Errorf("duplicate target %s", target.Host)
+		}
+		hosts[target.Host] = true
+		if _, ok := c.Modules[target.Module]; target.Module != "" && !ok {
+			return fmt.Errorf("target %s refers to unknown module %s", target.Host, target.Module)
+		}
+		base := time.Second * time.Duration(interval)
+		if every := roundInterval(time.Second*time.Duration(c.module(target).Interval), base); staleness > 0 && staleness <= every {
+			return fmt.Errorf("staleness of %s must be longer than the interval of %s of target %s", staleness, every, target.Host)
+		}
+		if err := target.SensorNames.validate(); err != nil {
+			return fmt.Errorf("target %s: %w", target.Host, err)
+		}
+		if err := target.SensorFilter.validate(); err != nil {
+			return fmt.Errorf("target %s: %w", target.Host, err)
+		}
+		if dir := target.Replay.Dir; dir != "" {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("replay directory %s of target %s does not exist", dir, target.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// reloadConfig loads the configuration again and swaps it in if it is valid.
+// State kept for targets that were removed or whose settings changed is
+// dropped.
+func reloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	newConfig, err := loadConfig()
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	lock.Lock()
+	oldConfig := config
+	config = newConfig
+	for host := range results {
+		if _, ok := findTarget(newConfig, host); !ok {
+			delete(results, host)
+		}
+	}
+	lock.Unlock()
+
+	// Sessions are logged in with the settings of the old configuration.
+	sessionsChanged := oldConfig.Global.Backend != newConfig.Global.Backend ||
+		oldConfig.Global.Session != newConfig.Global.Session
+	for _, old := range oldConfig.Targets {
+		target, ok := findTarget(newConfig, old.Host)
+		if ok && !sessionsChanged && sameTarget(old, target) {
+			continue
+		}
+		sessions.forget(old.Host)
+		if !ok {
+			forgetFRU(old.Host)
+			forgetSchedule(old.Host)
+			forgetLastErrors(old.Host)
+		}
+	}
+	sessions.configureKeepalive(newConfig)
+	if newConfig.Global.Interval != oldConfig.Global.Interval {
+		if err := reschedule(newConfig.Global.Interval); err != nil {
+			configReloadSuccess.Set(0)
+			return err
+		}
+	}
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	log.Infof("Reloaded configuration with %d targets", len(newConfig.Targets))
+	return nil
+}
+
+// sameTarget reports whether a target of one configuration has the same
+// settings as b of another, including those of its module and the global
+// ones it inherits.
+func sameTarget(a, b ipmiTarget) bool {
+	moduleA, moduleB := a.module(), b.module()
+	a.config, b.config = nil, nil
+	return reflect.DeepEqual(a, b) && reflect.DeepEqual(moduleA, moduleB)
+}
+
+// reloadHandler reloads the configuration on POST /-/reload.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This endpoint requires a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reloadConfig(); err != nil {
+		log.Errorf("Error reloading config: %s", err)
+		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// watchSIGHUP reloads the configuration whenever the process receives
+// SIGHUP.
+func watchSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := reloadConfig(); err != nil {
+			log.Errorf("Error reloading config: %s", err)
+		}
+	}
+}
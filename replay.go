@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	fixtureStdoutExt = ".txt"
+	fixtureStderrExt = ".stderr"
+)
+
+// fixtureModes maps arguments that switch a tool into another mode to the
+// suffix of its fixture, so ipmi-sel --info is replayed from ipmi-sel-info.
+var fixtureModes = map[string]string{
+	"--info": "info",
+}
+
+// replayConfig makes a target replay FreeIPMI output from fixtures instead
+// of querying a BMC.
+type replayConfig struct {
+	// Dir holds one fixture per command, e.g. ipmimonitoring.txt.
+	Dir string
+	// Files maps fixture names to files and takes precedence over Dir.
+	Files map[string]string
+}
+
+// missingFixtureError reports a command a replayed target has no fixture
+// for, which usually means the collector is not meant to run on it.
+type missingFixtureError struct {
+	Fixture string
+	Host    string
+}
+
+func (e *missingFixtureError) Error() string {
+	return fmt.Sprintf("no fixture for %s of target %s", e.Fixture, e.Host)
+}
+
+func (r replayConfig) enabled() bool {
+	return r.Dir != "" || len(r.Files) > 0
+}
+
+// fixturePath returns the stdout fixture of a command, or "" if there is
+// none.
+func (r replayConfig) fixturePath(fixture string) string {
+	if file, ok := r.Files[fixture]; ok {
+		return file
+	}
+	if r.Dir == "" {
+		return ""
+	}
+	return filepath.Join(r.Dir, fixture+fixtureStdoutExt)
+}
+
+// fixtureName names the fixture holding the output of a FreeIPMI command.
+func fixtureName(name string, extra []string) string {
+	for _, arg := range extra {
+		if mode, ok := fixtureModes[arg]; ok {
+			return name + "-" + mode
+		}
+	}
+	return name
+}
+
+// replayOutput returns the recorded output of a command. A command that
+// failed when it was recorded only has a stderr fixture next to where the
+// stdout one would be, and fails again with the same reason.
+func replayOutput(target ipmiTarget, name string, extra []string) ([]byte, error) {
+	fixture := fixtureName(name, extra)
+	path := target.Replay.fixturePath(fixture)
+	if path == "" {
+		return nil, &missingFixtureError{Fixture: fixture, Host: target.Host}
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		stderrPath := strings.TrimSuffix(path, fixtureStdoutExt) + fixtureStderrExt
+		if stderr, serr := ioutil.ReadFile(stderrPath); serr == nil {
+			return nil, &commandError{
+				Command:  name,
+				ExitCode: 1,
+				Reason:   classifyStderr(string(stderr)),
+				Stderr:   strings.TrimSpace(string(stderr)),
+				err:      fmt.Errorf("replayed failure from %s", stderrPath),
+			}
+		}
+		return nil, &missingFixtureError{Fixture: fixture, Host: target.Host}
+	}
+	return readFile(path)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestReplayGolden collects the targets of testdata/config.yml from their
+// fixtures and compares what /ipmi would expose to testdata/<host>.golden.
+func TestReplayGolden(t *testing.T) {
+	dir := *configDir
+	*configDir = "testdata"
+	defer func() { *configDir = dir }()
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range c.Targets {
+		// Drop what earlier runs left behind for the host.
+		forgetFRU(target.Host)
+		forgetLastErrors(target.Host)
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(targetCollector{ctx: context.Background(), target: target})
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("%s: %s", target.Host, err)
+		}
+		var out bytes.Buffer
+		for _, family := range families {
+			// The only value that differs between runs.
+			if family.GetName() == "ipmi_scrape_duration_seconds" {
+				continue
+			}
+			if _, err := expfmt.MetricFamilyToText(&out, family); err != nil {
+				t.Fatalf("%s: %s", target.Host, err)
+			}
+		}
+
+		golden := filepath.Join("testdata", target.Host+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), expected) {
+			t.Errorf("%s: output differs from %s, rerun with -update if intended:\n%s", target.Host, golden, out.String())
+		}
+	}
+}
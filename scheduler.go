@@ -0,0 +1,205 @@
+package main
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultConcurrency = 32
+	defaultMaxBackoff  = 600
+	// maxFailures caps the consecutive failures counted per target, past
+	// which the backoff does not grow anymore.
+	maxFailures = 16
+)
+
+var (
+	schedulerQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "queue_depth",
+			Help:      "Number of targets of the running collection cycle that have not started yet.",
+		},
+	)
+
+	schedulerInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "targets_in_flight",
+			Help:      "Number of targets being collected right now.",
+		},
+	)
+
+	schedulerSkippedCycles = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "skipped_cycles_total",
+			Help:      "Number of collection cycles skipped because the previous one was still running.",
+		},
+	)
+
+	backoffDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "backoff_seconds"),
+		"Current delay between collections of a failing target, 0 if it is healthy.",
+		[]string{"host"},
+		nil,
+	)
+
+	consecutiveFailuresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "consecutive_failures"),
+		"Number of consecutive collections of the target in which all collectors failed, capped at 16.",
+		[]string{"host"},
+		nil,
+	)
+
+	nextScrapeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "next_timestamp_seconds"),
+		"Earliest time at which the target is collected again.",
+		[]string{"host"},
+		nil,
+	)
+
+	schedules = struct {
+		sync.Mutex
+		targets map[string]*targetSchedule
+	}{targets: make(map[string]*targetSchedule)}
+)
+
+type targetSchedule struct {
+	nextDue  time.Time
+	failures int
+	backoff  time.Duration
+}
+
+// concurrency returns how many targets of c may be collected at once.
+func concurrency(c *Config) int {
+	if c.Global.Concurrency > 0 {
+		return c.Global.Concurrency
+	}
+	return defaultConcurrency
+}
+
+// targetOffset spreads the start of the targets over jitter seconds. The
+// offset of a host is the same in every cycle, so each BMC is still polled
+// at a regular interval.
+func targetOffset(host string, jitter int) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	return time.Duration(h.Sum32()%uint32(jitter*1000)) * time.Millisecond
+}
+
+// baseInterval returns the interval of the cron job running flush.
+func baseInterval(c *Config) time.Duration {
+	interval, _ := strconv.Atoi(c.Global.Interval)
+	return time.Second * time.Duration(interval)
+}
+
+// targetInterval returns how often target is collected when it is healthy.
+// Targets are only collected in the cycles started every base, so the
+// interval is rounded up to a multiple of base.
+func targetInterval(target ipmiTarget, base time.Duration) time.Duration {
+	return roundInterval(time.Second*time.Duration(target.module().Interval), base)
+}
+
+// roundInterval rounds interval up to a multiple of base, at least base.
+func roundInterval(interval, base time.Duration) time.Duration {
+	if base <= 0 {
+		return interval
+	}
+	if interval < base {
+		return base
+	}
+	return (interval + base - 1) / base * base
+}
+
+// maxBackoff returns the longest delay between collections of a failing
+// target configured in c.
+func maxBackoff(c *Config) time.Duration {
+	if c.Global.MaxBackoff > 0 {
+		return time.Second * time.Duration(c.Global.MaxBackoff)
+	}
+	return time.Second * defaultMaxBackoff
+}
+
+// backoffDelay doubles interval for every consecutive failure, up to max.
+func backoffDelay(interval time.Duration, failures int, max time.Duration) time.Duration {
+	if max < interval {
+		max = interval
+	}
+	delay := interval
+	for i := 0; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// targetDue reports whether host is to be collected in the cycle started at
+// now. Cron does not fire at exact multiples of the interval, so a target
+// due within half a cycle is collected right away.
+func targetDue(host string, now time.Time, base time.Duration) bool {
+	schedules.Lock()
+	defer schedules.Unlock()
+	s, ok := schedules.targets[host]
+	if !ok {
+		return true
+	}
+	return !now.Before(s.nextDue.Add(-base / 2))
+}
+
+// recordScrape schedules the next collection of target. A target on which
+// every collector failed is backed off exponentially.
+func recordScrape(target ipmiTarget, start time.Time, base time.Duration, status scrapeStatus) {
+	interval := targetInterval(target, base)
+	schedules.Lock()
+	defer schedules.Unlock()
+	s, ok := schedules.targets[target.Host]
+	if !ok {
+		s = &targetSchedule{}
+		schedules.targets[target.Host] = s
+	}
+	if !status.unreachable() {
+		s.failures = 0
+		s.backoff = 0
+		s.nextDue = start.Add(interval)
+		return
+	}
+	if s.failures < maxFailures {
+		s.failures++
+	}
+	s.backoff = backoffDelay(interval, s.failures, maxBackoff(target.settings()))
+	s.nextDue = start.Add(s.backoff)
+	log.Warnf("All collectors failed on %s %d times in a row, next attempt in %s", target.Host, s.failures, s.backoff)
+}
+
+// forgetSchedule drops the schedule of a host removed from the
+// configuration.
+func forgetSchedule(host string) {
+	schedules.Lock()
+	delete(schedules.targets, host)
+	schedules.Unlock()
+}
+
+// collectSchedules sends the backoff state of every target.
+func collectSchedules(ch chan<- prometheus.Metric) {
+	schedules.Lock()
+	defer schedules.Unlock()
+	for host, s := range schedules.targets {
+		ch <- prometheus.MustNewConstMetric(backoffDesc, prometheus.GaugeValue, s.backoff.Seconds(), host)
+		ch <- prometheus.MustNewConstMetric(consecutiveFailuresDesc, prometheus.GaugeValue, float64(s.failures), host)
+		ch <- prometheus.MustNewConstMetric(nextScrapeDesc, prometheus.GaugeValue, float64(s.nextDue.Unix()), host)
+	}
+}
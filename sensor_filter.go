@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// sensorFilter selects the sensors that are exported. Empty fields do not
+// restrict anything; a sensor has to pass every set field.
+type sensorFilter struct {
+	IDs        []int64
+	ExcludeIDs []int64 `yaml:"exclude_ids"`
+	// Types are sensor types as printed by FreeIPMI, e.g. Temperature or
+	// Power Supply.
+	Types        []string
+	ExcludeTypes []string `yaml:"exclude_types"`
+	// Name and ExcludeName are regular expressions matched against the
+	// name printed by the BMC, before normalization.
+	Name          string
+	ExcludeName   string   `yaml:"exclude_name"`
+	ExcludeStates []string `yaml:"exclude_states"`
+	// DropNA drops sensors without a reading.
+	DropNA bool `yaml:"drop_na"`
+
+	// include and exclude are Name and ExcludeName compiled by validate.
+	compiled         bool
+	include, exclude *regexp.Regexp
+}
+
+// compile compiles the name expressions, nil for those that are not set.
+func (f *sensorFilter) compile() (include, exclude *regexp.Regexp, err error) {
+	if f.Name != "" {
+		if include, err = regexp.Compile(f.Name); err != nil {
+			return nil, nil, fmt.Errorf("invalid sensor filter: %w", err)
+		}
+	}
+	if f.ExcludeName != "" {
+		if exclude, err = regexp.Compile(f.ExcludeName); err != nil {
+			return nil, nil, fmt.Errorf("invalid sensor filter: %w", err)
+		}
+	}
+	return include, exclude, nil
+}
+
+// validate compiles the name expressions once when the configuration is
+// loaded.
+func (f *sensorFilter) validate() error {
+	if f == nil {
+		return nil
+	}
+	include, exclude, err := f.compile()
+	if err != nil {
+		return err
+	}
+	f.include, f.exclude, f.compiled = include, exclude, true
+	return nil
+}
+
+// args returns the FreeIPMI arguments that keep the excluded sensors from
+// being read at all. Name and state filters can only be applied afterwards.
+func (f *sensorFilter) args() []string {
+	if f == nil {
+		return nil
+	}
+	var args []string
+	if len(f.IDs) > 0 {
+		args = append(args, "--record-ids="+joinIDs(f.IDs))
+	}
+	if len(f.ExcludeIDs) > 0 {
+		args = append(args, "--exclude-record-ids="+joinIDs(f.ExcludeIDs))
+	}
+	if len(f.Types) > 0 {
+		args = append(args, "--sensor-types="+joinTypes(f.Types))
+	}
+	if len(f.ExcludeTypes) > 0 {
+		args = append(args, "--exclude-sensor-types="+joinTypes(f.ExcludeTypes))
+	}
+	return args
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+// joinTypes lists sensor types the way FreeIPMI accepts them on the command
+// line, with underscores instead of spaces.
+func joinTypes(types []string) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = strings.Replace(strings.TrimSpace(t), " ", "_", -1)
+	}
+	return strings.Join(s, ",")
+}
+
+// sameSensorType compares sensor types ignoring case and the spelling of
+// spaces.
+func sameSensorType(a, b string) bool {
+	return strings.EqualFold(strings.Replace(a, "_", " ", -1), strings.Replace(b, "_", " ", -1))
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []string, t string) bool {
+	for _, i := range types {
+		if sameSensorType(i, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensorSelector returns whether a sensor of target passes its filter. The
+// state is "" for sensors without one.
+func sensorSelector(target ipmiTarget) func(id int64, name, sensorType, state string, value float64) bool {
+	f := target.module().SensorFilter
+	if f == nil {
+		return func(int64, string, string, string, float64) bool { return true }
+	}
+	include, exclude := f.include, f.exclude
+	if !f.compiled {
+		// Only configs built in code skip validateConfig.
+		var err error
+		if include, exclude, err = f.compile(); err != nil {
+			log.Errorf("Ignoring sensor name filter of %s: %s", target.Host, err)
+		}
+	}
+	return func(id int64, name, sensorType, state string, value float64) bool {
+		switch {
+		case len(f.IDs) > 0 && !containsID(f.IDs, id),
+			containsID(f.ExcludeIDs, id),
+			len(f.Types) > 0 && !containsType(f.Types, sensorType),
+			containsType(f.ExcludeTypes, sensorType),
+			include != nil && !include.MatchString(name),
+			exclude != nil && exclude.MatchString(name),
+			f.DropNA && math.IsNaN(value):
+			return false
+		}
+		for _, s := range f.ExcludeStates {
+			if state != "" && strings.EqualFold(s, state) {
+				return false
+			}
+		}
+		return true
+	}
+}
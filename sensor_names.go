@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// sensorNamePresetLegacy is the naming of older releases and the default.
+const sensorNamePresetLegacy = "legacy"
+
+// sensorNamePresets are built-in rule sets for the sensor names of common
+// vendors, e.g. HP's "02-CPU 1" becomes cpu_1.
+var sensorNamePresets = map[string][]sensorNameRule{
+	"hp": {
+		{Replace: `^\d+-`},
+		{Replace: `[^A-Za-z0-9]+`, With: "_"},
+		{Replace: `^_|_$`},
+		{Lowercase: true},
+	},
+	"sugon": {
+		{StripPrefix: "TEMP_"},
+		{StripPrefix: "PV_"},
+		{Replace: `[^A-Za-z0-9]+`, With: "_"},
+		{Replace: `^_|_$`},
+		{Lowercase: true},
+	},
+}
+
+// sensorNaming configures how the sensor names printed by the BMC are turned
+// into the name label. The printed name is always kept in raw_name.
+type sensorNaming struct {
+	// Preset applies built-in rules before Rules: legacy (the default), hp
+	// or sugon.
+	Preset string
+	Rules  []sensorNameRule
+	// KeepOriginal uses the printed name as is and ignores all rules.
+	KeepOriginal bool `yaml:"keep_original"`
+
+	// pipeline holds the preset and user rules compiled by validate.
+	pipeline *sensorNamePipeline
+}
+
+// sensorNameRule is one step of the pipeline. The actions of a rule are
+// applied in the order of the fields.
+type sensorNameRule struct {
+	// Replace is a regular expression whose matches are replaced by With.
+	Replace string
+	With    string
+	// StripPrefix removes a literal prefix.
+	StripPrefix string `yaml:"strip_prefix"`
+	Lowercase   bool
+}
+
+func (r sensorNameRule) apply(name string, re *regexp.Regexp) string {
+	if re != nil {
+		name = re.ReplaceAllString(name, r.With)
+	}
+	name = strings.TrimPrefix(name, r.StripPrefix)
+	if r.Lowercase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// sensorNamePipeline is a compiled sensorNaming.
+type sensorNamePipeline struct {
+	legacy  bool
+	rules   []sensorNameRule
+	regexps []*regexp.Regexp
+}
+
+func (p *sensorNamePipeline) apply(name string) string {
+	name = strings.TrimSpace(name)
+	if p.legacy {
+		name = sensorName(name)
+	}
+	for i, rule := range p.rules {
+		name = rule.apply(name, p.regexps[i])
+	}
+	return name
+}
+
+// compile checks the preset and compiles the preset and user rules.
+func (n *sensorNaming) compile() (*sensorNamePipeline, error) {
+	if _, ok := sensorNamePresets[n.Preset]; !ok && n.Preset != "" && n.Preset != sensorNamePresetLegacy {
+		return nil, fmt.Errorf("unknown sensor name preset %s", n.Preset)
+	}
+	p := &sensorNamePipeline{
+		legacy: n.Preset == "" || n.Preset == sensorNamePresetLegacy,
+		rules:  append(append([]sensorNameRule(nil), sensorNamePresets[n.Preset]...), n.Rules...),
+	}
+	p.regexps = make([]*regexp.Regexp, len(p.rules))
+	for i, rule := range p.rules {
+		if rule.Replace == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule.Replace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sensor name rule: %w", err)
+		}
+		p.regexps[i] = re
+	}
+	return p, nil
+}
+
+// validate compiles the naming once when the configuration is loaded.
+func (n *sensorNaming) validate() error {
+	if n == nil {
+		return nil
+	}
+	p, err := n.compile()
+	if err != nil {
+		return err
+	}
+	n.pipeline = p
+	return nil
+}
+
+// sensorNamer returns the function normalizing the sensor names of target.
+func sensorNamer(target ipmiTarget) func(string) string {
+	naming := target.module().SensorNames
+	if naming == nil {
+		return sensorName
+	}
+	if naming.KeepOriginal {
+		return strings.TrimSpace
+	}
+	p := naming.pipeline
+	if p == nil {
+		// Only configs built in code skip validateConfig.
+		var err error
+		if p, err = naming.compile(); err != nil {
+			log.Errorf("Ignoring sensor names of %s: %s", target.Host, err)
+			return sensorName
+		}
+	}
+	return p.apply
+}
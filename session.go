@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/soundcloud/ipmi_exporter/ipmi"
+)
+
+var (
+	sessionLogins = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "logins_total",
+			Help:      "Number of RMCP+ session logins performed against a BMC.",
+		},
+		[]string{"host"},
+	)
+
+	sessionRelogins = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "relogins_total",
+			Help:      "Number of logins that replaced an expired or failed session.",
+		},
+		[]string{"host"},
+	)
+
+	sessionReuses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "reuses_total",
+			Help:      "Number of times a collector reused an already established session.",
+		},
+		[]string{"host"},
+	)
+
+	sessions = &sessionManager{sessions: make(map[string]*managedSession)}
+)
+
+// keepaliveTimeout bounds a single keepalive ping, so an unreachable BMC
+// holds its session for at most this long.
+const keepaliveTimeout = 5 * time.Second
+
+type managedSession struct {
+	// inUse holds a token while a collector or the keepalive uses the
+	// session. Unlike a mutex it can be tried and waited for with a
+	// deadline.
+	inUse    chan struct{}
+	client   *ipmi.Client
+	lastUsed time.Time
+	// lost is set when the session expired or failed, so the next login
+	// is accounted as a re-login.
+	lost bool
+}
+
+// sessionManager keeps one native IPMI session per target, shared by all
+// collectors of a scrape and, if configured, across scrapes.
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*managedSession
+	// keepaliveInterval is that of the running keepalive, which is stopped
+	// by closing stopKeepalive.
+	keepaliveInterval time.Duration
+	stopKeepalive     chan struct{}
+}
+
+func (m *sessionManager) get(host string) *managedSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[host]
+	if !ok {
+		s = &managedSession{inUse: make(chan struct{}, 1)}
+		m.sessions[host] = s
+	}
+	return s
+}
+
+// acquire waits until the session is free or ctx is done.
+func (s *managedSession) acquire(ctx context.Context) error {
+	select {
+	case s.inUse <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryAcquire takes the session if it is free.
+func (s *managedSession) tryAcquire() bool {
+	select {
+	case s.inUse <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *managedSession) release() {
+	<-s.inUse
+}
+
+func (m *sessionManager) all() []*managedSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]*managedSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		result = append(result, s)
+	}
+	return result
+}
+
+// forget closes and removes the session of a host, e.g. when the target was
+// removed from the configuration or its credentials changed.
+func (m *sessionManager) forget(host string) {
+	m.mu.Lock()
+	s, ok := m.sessions[host]
+	delete(m.sessions, host)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.acquire(context.Background())
+	defer s.release()
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// withSession runs fn with an established session to the target, logging in
+// when needed. If fn fails because the session expired, it logs in again and
+// retries fn once.
+func (m *sessionManager) withSession(ctx context.Context, target ipmiTarget, fn func(client *ipmi.Client) error) error {
+	s := m.get(target.Host)
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	if err := s.login(ctx, target); err != nil {
+		return err
+	}
+	err := fn(s.client)
+	if err != nil && sessionLost(err) && ctx.Err() == nil {
+		log.Warnf("IPMI session to %s lost, logging in again: %s", target.Host, err)
+		s.drop()
+		if err := s.login(ctx, target); err != nil {
+			return err
+		}
+		err = fn(s.client)
+	}
+	s.lastUsed = time.Now()
+	return err
+}
+
+// release closes the target's session at the end of a scrape unless sessions
+// are kept across scrapes.
+func (m *sessionManager) release(target ipmiTarget) {
+	if target.settings().Global.Session.Persistent {
+		return
+	}
+	s := m.get(target.Host)
+	s.acquire(context.Background())
+	defer s.release()
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// configureKeepalive starts, restarts or stops the keepalive of persistent
+// sessions to match c, on startup and after every reload.
+func (m *sessionManager) configureKeepalive(c *Config) {
+	var interval time.Duration
+	if nativeBackend(c) && c.Global.Session.Persistent && c.Global.Session.KeepAlive > 0 {
+		interval = time.Second * time.Duration(c.Global.Session.KeepAlive)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if interval == m.keepaliveInterval {
+		return
+	}
+	if m.stopKeepalive != nil {
+		close(m.stopKeepalive)
+		m.stopKeepalive = nil
+	}
+	m.keepaliveInterval = interval
+	if interval > 0 {
+		m.stopKeepalive = make(chan struct{})
+		go m.keepalive(interval, m.stopKeepalive)
+	}
+}
+
+// keepalive pings idle persistent sessions so the BMC does not expire them
+// between scrapes, until stop is closed. Sessions in use by a collector are
+// not idle and skipped.
+func (m *sessionManager) keepalive(interval time.Duration, stop <-chan struct{}) {
+	timeout := keepaliveTimeout
+	if interval < timeout {
+		timeout = interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		for _, s := range m.all() {
+			if !s.tryAcquire() {
+				continue
+			}
+			if s.client != nil && time.Since(s.lastUsed) >= interval {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				if _, err := s.client.GetDeviceID(ctx); err != nil {
+					log.Warnf("IPMI session keepalive to %s failed: %s", s.client.Host, err)
+					s.drop()
+				} else {
+					s.lastUsed = time.Now()
+				}
+				cancel()
+			}
+			s.release()
+		}
+	}
+}
+
+func (s *managedSession) login(ctx context.Context, target ipmiTarget) error {
+	if s.client != nil && s.client.Active() {
+		sessionReuses.WithLabelValues(target.Host).Inc()
+		return nil
+	}
+	client := ipmi.NewClient(target.Host, target.User, target.password)
+	module := target.module()
+	if module.Privilege != "" {
+		privilege, err := ipmi.ParsePrivilegeLevel(module.Privilege)
+		if err != nil {
+			return err
+		}
+		client.Privilege = privilege
+	}
+	if module.CipherSuite != nil {
+		client.CipherSuite = *module.CipherSuite
+	}
+	if err := client.Open(ctx); err != nil {
+		return err
+	}
+	sessionLogins.WithLabelValues(target.Host).Inc()
+	if s.lost {
+		sessionRelogins.WithLabelValues(target.Host).Inc()
+	}
+	s.client = client
+	s.lost = false
+	return nil
+}
+
+func (s *managedSession) drop() {
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	s.lost = true
+}
+
+// sessionLost reports whether err indicates the BMC no longer knows the
+// session, in which case logging in again may help.
+func sessionLost(err error) bool {
+	var code ipmi.CompletionCode
+	if errors.As(err, &code) {
+		return code == ipmi.CompletionInvalidSessionID
+	}
+	return errors.Is(err, ipmi.ErrTimeout) || errors.Is(err, ipmi.ErrSessionClosed)
+}